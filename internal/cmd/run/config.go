@@ -0,0 +1,472 @@
+package run
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+)
+
+const (
+	// EnvironmentVariablesPrefix is the prefix of the environment variables bound to flags.
+	// i.e. flag '--metrics-port' is bound to 'TEKTON_EXPORTER_METRICS_PORT'
+	EnvironmentVariablesPrefix = "TEKTON_EXPORTER_"
+)
+
+// bindEnvironment set the flags not explicitly set by the user from their environment variables, when defined.
+// This way, precedence order is: flag > environment variable > configuration file > default
+func bindEnvironment(cmd *cobra.Command) (err error) {
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed {
+			return
+		}
+
+		value, found := os.LookupEnv(getEnvironmentVariableName(flag.Name))
+		if !found {
+			return
+		}
+
+		// Flags set this way are considered changed, so they override the configuration file
+		if setErr := cmd.Flags().Set(flag.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %w", getEnvironmentVariableName(flag.Name), setErr)
+		}
+	})
+
+	return err
+}
+
+// applyKubeconfigFlag pass the kubeconfig set by the user (by flag or environment variable) to controller-runtime,
+// as it reads it from the standard flag set, which is not parsed by cobra
+func applyKubeconfigFlag(cmd *cobra.Command) error {
+	if !cmd.Flags().Changed(ctrlconfig.KubeconfigFlagName) {
+		return nil
+	}
+
+	kubeconfigPath, err := cmd.Flags().GetString(ctrlconfig.KubeconfigFlagName)
+	if err != nil {
+		return err
+	}
+
+	// Paths are not expanded by the shell when they are quoted or defined in environment variables
+	if strings.HasPrefix(kubeconfigPath, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		kubeconfigPath = filepath.Join(homeDir, kubeconfigPath[2:])
+	}
+
+	return flag.Set(ctrlconfig.KubeconfigFlagName, kubeconfigPath)
+}
+
+// getEnvironmentVariableName return the name of the environment variable bound to a flag
+func getEnvironmentVariableName(flagName string) string {
+	return EnvironmentVariablesPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// getConfig return the configuration defined in the file at configPath (or the default one when it is empty),
+// overridden by the flags explicitly set by the user. The returned configuration is already validated
+func getConfig(cmd *cobra.Command, configPath string) (currentConfig *config.Config, err error) {
+
+	currentConfig = config.NewDefault()
+	if configPath != "" {
+		currentConfig, err = config.LoadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = applyFlags(cmd, currentConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	err = currentConfig.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return currentConfig, nil
+}
+
+// applyFlags override the configuration with the flags explicitly set by the user.
+// Flags not set by the user are ignored, so they don't override values from the configuration file
+func applyFlags(cmd *cobra.Command, currentConfig *config.Config) (err error) {
+	flags := cmd.Flags()
+
+	if flags.Changed("metrics-port") {
+		currentConfig.Outputs.Prometheus.Port, err = flags.GetString("metrics-port")
+		if err != nil {
+			return fmt.Errorf(MetricsPortFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("metrics-host") {
+		currentConfig.Outputs.Prometheus.Host, err = flags.GetString("metrics-host")
+		if err != nil {
+			return fmt.Errorf(MetricsHostFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("leader-election") {
+		currentConfig.LeaderElection.Enabled, err = flags.GetBool("leader-election")
+		if err != nil {
+			return fmt.Errorf(LeaderElectionFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("leader-election-lease-name") {
+		currentConfig.LeaderElection.LeaseName, err = flags.GetString("leader-election-lease-name")
+		if err != nil {
+			return fmt.Errorf(LeaderElectionLeaseNameFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("leader-election-namespace") {
+		currentConfig.LeaderElection.Namespace, err = flags.GetString("leader-election-namespace")
+		if err != nil {
+			return fmt.Errorf(LeaderElectionNamespaceFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("shard-index") {
+		currentConfig.Watch.Shard.Index, err = flags.GetInt("shard-index")
+		if err != nil {
+			return fmt.Errorf(ShardIndexFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("shard-count") {
+		currentConfig.Watch.Shard.Count, err = flags.GetInt("shard-count")
+		if err != nil {
+			return fmt.Errorf(ShardCountFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("shard-key") {
+		currentConfig.Watch.Shard.Key, err = flags.GetString("shard-key")
+		if err != nil {
+			return fmt.Errorf(ShardKeyFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("watcher-backoff-initial-interval") {
+		currentConfig.Watch.Backoff.InitialInterval, err = flags.GetDuration("watcher-backoff-initial-interval")
+		if err != nil {
+			return fmt.Errorf(WatcherBackoffInitialIntervalFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("watcher-backoff-max-interval") {
+		currentConfig.Watch.Backoff.MaxInterval, err = flags.GetDuration("watcher-backoff-max-interval")
+		if err != nil {
+			return fmt.Errorf(WatcherBackoffMaxIntervalFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("metrics-tls-cert-file") {
+		currentConfig.Outputs.Prometheus.TLS.CertFile, err = flags.GetString("metrics-tls-cert-file")
+		if err != nil {
+			return fmt.Errorf(MetricsTLSCertFileFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("metrics-tls-key-file") {
+		currentConfig.Outputs.Prometheus.TLS.KeyFile, err = flags.GetString("metrics-tls-key-file")
+		if err != nil {
+			return fmt.Errorf(MetricsTLSKeyFileFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("metrics-tls-client-ca-file") {
+		currentConfig.Outputs.Prometheus.TLS.ClientCAFile, err = flags.GetString("metrics-tls-client-ca-file")
+		if err != nil {
+			return fmt.Errorf(MetricsTLSClientCAFileFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("metrics-auth") {
+		currentConfig.Outputs.Prometheus.Auth, err = flags.GetString("metrics-auth")
+		if err != nil {
+			return fmt.Errorf(MetricsAuthFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("otlp-endpoint") {
+		currentConfig.Outputs.OTLP.Endpoint, err = flags.GetString("otlp-endpoint")
+		if err != nil {
+			return fmt.Errorf(OTLPEndpointFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("otlp-protocol") {
+		currentConfig.Outputs.OTLP.Protocol, err = flags.GetString("otlp-protocol")
+		if err != nil {
+			return fmt.Errorf(OTLPProtocolFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("otlp-insecure") {
+		currentConfig.Outputs.OTLP.Insecure, err = flags.GetBool("otlp-insecure")
+		if err != nil {
+			return fmt.Errorf(OTLPInsecureFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("otlp-metrics") {
+		currentConfig.Outputs.OTLP.Metrics, err = flags.GetBool("otlp-metrics")
+		if err != nil {
+			return fmt.Errorf(OTLPMetricsFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("otlp-traces") {
+		currentConfig.Outputs.OTLP.Traces, err = flags.GetBool("otlp-traces")
+		if err != nil {
+			return fmt.Errorf(OTLPTracesFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("otlp-interval") {
+		currentConfig.Outputs.OTLP.Interval, err = flags.GetDuration("otlp-interval")
+		if err != nil {
+			return fmt.Errorf(OTLPIntervalFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("otlp-headers") {
+		currentConfig.Outputs.OTLP.Headers, err = flags.GetStringToString("otlp-headers")
+		if err != nil {
+			return fmt.Errorf(OTLPHeadersFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("otlp-resource-attributes") {
+		currentConfig.Outputs.OTLP.ResourceAttributes, err = flags.GetStringToString("otlp-resource-attributes")
+		if err != nil {
+			return fmt.Errorf(OTLPResourceAttributesFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("pushgateway-url") {
+		currentConfig.Outputs.Pushgateway.URL, err = flags.GetString("pushgateway-url")
+		if err != nil {
+			return fmt.Errorf(PushgatewayURLFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("pushgateway-job") {
+		currentConfig.Outputs.Pushgateway.Job, err = flags.GetString("pushgateway-job")
+		if err != nil {
+			return fmt.Errorf(PushgatewayJobFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("pushgateway-interval") {
+		currentConfig.Outputs.Pushgateway.Interval, err = flags.GetDuration("pushgateway-interval")
+		if err != nil {
+			return fmt.Errorf(PushgatewayIntervalFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("pushgateway-grouping") {
+		currentConfig.Outputs.Pushgateway.Grouping, err = flags.GetStringToString("pushgateway-grouping")
+		if err != nil {
+			return fmt.Errorf(PushgatewayGroupingFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("remote-write-url") {
+		currentConfig.Outputs.RemoteWrite.URL, err = flags.GetString("remote-write-url")
+		if err != nil {
+			return fmt.Errorf(RemoteWriteURLFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("remote-write-interval") {
+		currentConfig.Outputs.RemoteWrite.Interval, err = flags.GetDuration("remote-write-interval")
+		if err != nil {
+			return fmt.Errorf(RemoteWriteIntervalFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("remote-write-external-labels") {
+		currentConfig.Outputs.RemoteWrite.ExternalLabels, err = flags.GetStringToString("remote-write-external-labels")
+		if err != nil {
+			return fmt.Errorf(RemoteWriteExternalLabelsFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("remote-write-headers") {
+		currentConfig.Outputs.RemoteWrite.Headers, err = flags.GetStringToString("remote-write-headers")
+		if err != nil {
+			return fmt.Errorf(RemoteWriteHeadersFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("remote-write-shards") {
+		currentConfig.Outputs.RemoteWrite.Queue.Shards, err = flags.GetInt("remote-write-shards")
+		if err != nil {
+			return fmt.Errorf(RemoteWriteShardsFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("statsd-address") {
+		currentConfig.Outputs.StatsD.Address, err = flags.GetString("statsd-address")
+		if err != nil {
+			return fmt.Errorf(StatsDAddressFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("statsd-flavor") {
+		currentConfig.Outputs.StatsD.Flavor, err = flags.GetString("statsd-flavor")
+		if err != nil {
+			return fmt.Errorf(StatsDFlavorFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("statsd-prefix") {
+		currentConfig.Outputs.StatsD.Prefix, err = flags.GetString("statsd-prefix")
+		if err != nil {
+			return fmt.Errorf(StatsDPrefixFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("statsd-tags") {
+		currentConfig.Outputs.StatsD.Tags, err = flags.GetStringToString("statsd-tags")
+		if err != nil {
+			return fmt.Errorf(StatsDTagsFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("event-log-sink") {
+		currentConfig.Outputs.EventLog.Sink, err = flags.GetString("event-log-sink")
+		if err != nil {
+			return fmt.Errorf(EventLogSinkFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("event-log-file") {
+		currentConfig.Outputs.EventLog.File.Path, err = flags.GetString("event-log-file")
+		if err != nil {
+			return fmt.Errorf(EventLogFileFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("event-log-url") {
+		currentConfig.Outputs.EventLog.HTTP.URL, err = flags.GetString("event-log-url")
+		if err != nil {
+			return fmt.Errorf(EventLogURLFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("cloudevents-sink") {
+		currentConfig.Outputs.CloudEvents.Sink, err = flags.GetString("cloudevents-sink")
+		if err != nil {
+			return fmt.Errorf(CloudEventsSinkFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("cloudevents-namespace-sinks") {
+		currentConfig.Outputs.CloudEvents.NamespaceSinks, err = flags.GetStringToString("cloudevents-namespace-sinks")
+		if err != nil {
+			return fmt.Errorf(CloudEventsNamespaceSinksFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("cloudevents-mode") {
+		currentConfig.Outputs.CloudEvents.Mode, err = flags.GetString("cloudevents-mode")
+		if err != nil {
+			return fmt.Errorf(CloudEventsModeFlagErrorMessage, err)
+		}
+	}
+
+	// Handle a potentially confusing situation:
+	// Cobra flags' library does not properly parse
+	// comma-separated lists depending on the environment
+	// the CLI is running (i.e. Kubernetes),
+	if flags.Changed("populated-labels") {
+		currentConfig.Labels.Populated, err = flags.GetStringSlice("populated-labels")
+		if err != nil {
+			return fmt.Errorf(PopulatedLabelsFlagErrorMessage, err)
+		}
+		currentConfig.Labels.Populated = globals.SplitCommaSeparatedValues(currentConfig.Labels.Populated)
+	}
+
+	if flags.Changed("populated-labels-placement") {
+		currentConfig.Labels.Placement, err = flags.GetString("populated-labels-placement")
+		if err != nil {
+			return fmt.Errorf(PopulatedLabelsPlacementFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("completed-runs-ttl") {
+		currentConfig.Metrics.CompletedRunsTTL, err = flags.GetDuration("completed-runs-ttl")
+		if err != nil {
+			return fmt.Errorf(CompletedRunsTTLFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("flakiness-window-size") {
+		currentConfig.Metrics.Flakiness.WindowSize, err = flags.GetInt("flakiness-window-size")
+		if err != nil {
+			return fmt.Errorf(FlakinessWindowFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("deployment-label-selector") {
+		currentConfig.Metrics.Dora.LabelSelector, err = flags.GetString("deployment-label-selector")
+		if err != nil {
+			return fmt.Errorf(DeploymentLabelSelectorFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("deployment-annotation-selector") {
+		currentConfig.Metrics.Dora.AnnotationSelector, err = flags.GetString("deployment-annotation-selector")
+		if err != nil {
+			return fmt.Errorf(DeploymentAnnotationSelectorFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("deployment-service-label") {
+		currentConfig.Metrics.Dora.ServiceLabel, err = flags.GetString("deployment-service-label")
+		if err != nil {
+			return fmt.Errorf(DeploymentServiceLabelFlagErrorMessage, err)
+		}
+	}
+
+	if flags.Changed("git-repository-params") {
+		currentConfig.Metrics.GitInfo.RepositoryParams, err = flags.GetStringSlice("git-repository-params")
+		if err != nil {
+			return fmt.Errorf(GitRepositoryParamsFlagErrorMessage, err)
+		}
+		currentConfig.Metrics.GitInfo.RepositoryParams = globals.SplitCommaSeparatedValues(currentConfig.Metrics.GitInfo.RepositoryParams)
+	}
+
+	if flags.Changed("git-revision-params") {
+		currentConfig.Metrics.GitInfo.RevisionParams, err = flags.GetStringSlice("git-revision-params")
+		if err != nil {
+			return fmt.Errorf(GitRevisionParamsFlagErrorMessage, err)
+		}
+		currentConfig.Metrics.GitInfo.RevisionParams = globals.SplitCommaSeparatedValues(currentConfig.Metrics.GitInfo.RevisionParams)
+	}
+
+	if flags.Changed("git-branch-params") {
+		currentConfig.Metrics.GitInfo.BranchParams, err = flags.GetStringSlice("git-branch-params")
+		if err != nil {
+			return fmt.Errorf(GitBranchParamsFlagErrorMessage, err)
+		}
+		currentConfig.Metrics.GitInfo.BranchParams = globals.SplitCommaSeparatedValues(currentConfig.Metrics.GitInfo.BranchParams)
+	}
+
+	return nil
+}
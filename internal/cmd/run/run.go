@@ -2,12 +2,31 @@ package run
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net/http"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"syscall"
+	"tekton-exporter/internal/config"
 	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/health"
 	"tekton-exporter/internal/kubernetes"
 	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/outputs/cloudevents"
+	"tekton-exporter/internal/outputs/eventlog"
+	"tekton-exporter/internal/outputs/otlp"
+	"tekton-exporter/internal/outputs/pushgateway"
+	"tekton-exporter/internal/outputs/remotewrite"
+	"tekton-exporter/internal/outputs/statsd"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/webserver"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -18,12 +37,99 @@ const (
 	descriptionLong = `
 	Run execute metrics exporter`
 
-	LogLevelFlagErrorMessage        = "impossible to get flag --log-level: %s"
-	DisableTraceFlagErrorMessage    = "impossible to get flag --disable-trace: %s"
-	MetricsPortFlagErrorMessage     = "impossible to get flag --metrics-port: %s"
-	MetricsHostFlagErrorMessage     = "impossible to get flag --metrics-host: %s"
-	MetricsWebserverErrorMessage    = "imposible to launch metrics webserver: %s"
-	PopulatedLabelsFlagErrorMessage = "impossible to get flag --populated-labels: %s"
+	LogLevelFlagErrorMessage               = "impossible to get flag --log-level: %s"
+	DisableTraceFlagErrorMessage           = "impossible to get flag --disable-trace: %s"
+	MetricsPortFlagErrorMessage            = "impossible to get flag --metrics-port: %s"
+	MetricsHostFlagErrorMessage            = "impossible to get flag --metrics-host: %s"
+	MetricsWebserverErrorMessage           = "imposible to launch metrics webserver: %s"
+	MetricsTLSCertFileFlagErrorMessage     = "impossible to get flag --metrics-tls-cert-file: %s"
+	MetricsTLSKeyFileFlagErrorMessage      = "impossible to get flag --metrics-tls-key-file: %s"
+	MetricsTLSClientCAFileFlagErrorMessage = "impossible to get flag --metrics-tls-client-ca-file: %s"
+	MetricsAuthFlagErrorMessage            = "impossible to get flag --metrics-auth: %s"
+	MetricsTLSErrorMessage                 = "impossible to configure TLS for metrics webserver: %s"
+	MetricsTLSWatcherErrorMessage          = "error on TLS certificate watcher: %s"
+	MetricsAuthErrorMessage                = "impossible to configure authentication for metrics webserver: %s"
+	PopulatedLabelsFlagErrorMessage        = "impossible to get flag --populated-labels: %s"
+	FlakinessWindowFlagErrorMessage        = "impossible to get flag --flakiness-window-size: %s"
+	CompletedRunsTTLFlagErrorMessage       = "impossible to get flag --completed-runs-ttl: %s"
+
+	PopulatedLabelsPlacementFlagErrorMessage = "impossible to get flag --populated-labels-placement: %s"
+
+	DeploymentLabelSelectorFlagErrorMessage      = "impossible to get flag --deployment-label-selector: %s"
+	DeploymentAnnotationSelectorFlagErrorMessage = "impossible to get flag --deployment-annotation-selector: %s"
+	DeploymentServiceLabelFlagErrorMessage       = "impossible to get flag --deployment-service-label: %s"
+
+	GitRepositoryParamsFlagErrorMessage = "impossible to get flag --git-repository-params: %s"
+	GitRevisionParamsFlagErrorMessage   = "impossible to get flag --git-revision-params: %s"
+	GitBranchParamsFlagErrorMessage     = "impossible to get flag --git-branch-params: %s"
+
+	ShardIndexFlagErrorMessage = "impossible to get flag --shard-index: %s"
+	ShardCountFlagErrorMessage = "impossible to get flag --shard-count: %s"
+	ShardKeyFlagErrorMessage   = "impossible to get flag --shard-key: %s"
+
+	OTLPEndpointFlagErrorMessage           = "impossible to get flag --otlp-endpoint: %s"
+	OTLPProtocolFlagErrorMessage           = "impossible to get flag --otlp-protocol: %s"
+	OTLPInsecureFlagErrorMessage           = "impossible to get flag --otlp-insecure: %s"
+	OTLPIntervalFlagErrorMessage           = "impossible to get flag --otlp-interval: %s"
+	OTLPHeadersFlagErrorMessage            = "impossible to get flag --otlp-headers: %s"
+	OTLPResourceAttributesFlagErrorMessage = "impossible to get flag --otlp-resource-attributes: %s"
+	OTLPMetricsFlagErrorMessage            = "impossible to get flag --otlp-metrics: %s"
+	OTLPTracesFlagErrorMessage             = "impossible to get flag --otlp-traces: %s"
+	OTLPExporterErrorMessage               = "error on OTLP metrics exporter: %s"
+	OTLPTracesExporterErrorMessage         = "error on OTLP traces exporter: %s"
+
+	PushgatewayURLFlagErrorMessage      = "impossible to get flag --pushgateway-url: %s"
+	PushgatewayJobFlagErrorMessage      = "impossible to get flag --pushgateway-job: %s"
+	PushgatewayIntervalFlagErrorMessage = "impossible to get flag --pushgateway-interval: %s"
+	PushgatewayGroupingFlagErrorMessage = "impossible to get flag --pushgateway-grouping: %s"
+
+	RemoteWriteURLFlagErrorMessage            = "impossible to get flag --remote-write-url: %s"
+	RemoteWriteIntervalFlagErrorMessage       = "impossible to get flag --remote-write-interval: %s"
+	RemoteWriteExternalLabelsFlagErrorMessage = "impossible to get flag --remote-write-external-labels: %s"
+	RemoteWriteHeadersFlagErrorMessage        = "impossible to get flag --remote-write-headers: %s"
+	RemoteWriteShardsFlagErrorMessage         = "impossible to get flag --remote-write-shards: %s"
+
+	StatsDAddressFlagErrorMessage = "impossible to get flag --statsd-address: %s"
+	StatsDFlavorFlagErrorMessage  = "impossible to get flag --statsd-flavor: %s"
+	StatsDPrefixFlagErrorMessage  = "impossible to get flag --statsd-prefix: %s"
+	StatsDTagsFlagErrorMessage    = "impossible to get flag --statsd-tags: %s"
+	StatsDEmitterErrorMessage     = "impossible to create statsd emitter: %s"
+
+	EventLogSinkFlagErrorMessage = "impossible to get flag --event-log-sink: %s"
+	EventLogFileFlagErrorMessage = "impossible to get flag --event-log-file: %s"
+	EventLogURLFlagErrorMessage  = "impossible to get flag --event-log-url: %s"
+	EventLogWriterErrorMessage   = "impossible to create event log writer: %s"
+
+	CloudEventsSinkFlagErrorMessage           = "impossible to get flag --cloudevents-sink: %s"
+	CloudEventsNamespaceSinksFlagErrorMessage = "impossible to get flag --cloudevents-namespace-sinks: %s"
+	CloudEventsModeFlagErrorMessage           = "impossible to get flag --cloudevents-mode: %s"
+
+	KubeconfigFlagErrorMessage                    = "impossible to set flag --kubeconfig: %s"
+	WatcherBackoffInitialIntervalFlagErrorMessage = "impossible to get flag --watcher-backoff-initial-interval: %s"
+	WatcherBackoffMaxIntervalFlagErrorMessage     = "impossible to get flag --watcher-backoff-max-interval: %s"
+	KubernetesClientErrorMessage                  = "impossible to create Kubernetes client: %s"
+
+	LeaderElectionFlagErrorMessage          = "impossible to get flag --leader-election: %s"
+	LeaderElectionLeaseNameFlagErrorMessage = "impossible to get flag --leader-election-lease-name: %s"
+	LeaderElectionNamespaceFlagErrorMessage = "impossible to get flag --leader-election-namespace: %s"
+	LeaderElectionErrorMessage              = "error on leader election: %s"
+
+	ShutdownTimeoutFlagErrorMessage = "impossible to get flag --shutdown-timeout: %s"
+	ShutdownStartedMessage          = "shutdown signal received. Draining in-flight work for up to %s"
+	ShutdownTimeoutMessage          = "shutdown timeout reached. Exiting without waiting for pending work"
+	ShutdownCompletedMessage        = "shutdown completed"
+
+	EnvironmentErrorMessage = "impossible to set flags from environment variables: %s"
+
+	ConfigFlagErrorMessage                     = "impossible to get flag --config: %s"
+	ConfigLoadErrorMessage                     = "impossible to load configuration: %s"
+	ConfigWatcherErrorMessage                  = "error on config file watcher: %s"
+	ConfigReloadErrorMessage                   = "impossible to reload configuration: %s"
+	ConfigReregisterErrorMessage               = "impossible to register metrics with the new configuration: %w"
+	ConfigEffectiveMessage                     = "effective configuration:\n%s"
+	ConfigClustersRestartRequiredMessage       = "changes on clusters require a restart to take effect"
+	ConfigLeaderElectionRestartRequiredMessage = "changes on leaderElection require a restart to take effect"
+	ConfigRestartRequiredMessage               = "changes on outputs require a restart to take effect"
 	//WatchAllNamespacesFlagErrorMessage = "impossible to get flag --watch-all-namespaces: %s"
 	//WatchNamespaceFlagErrorMessage     = "impossible to get flag --watch-namespace: %s"
 )
@@ -38,18 +144,81 @@ func NewCommand() *cobra.Command {
 		Run: RunCommand,
 	}
 
+	// Default values of the flags overriding configuration come from the default configuration
+	defaultConfig := config.NewDefault()
+
 	//
+	cmd.Flags().String("config", "", "Path to the YAML configuration file. It is reloaded when it changes")
 	cmd.Flags().String("log-level", "info", "Verbosity level for logs")
 	cmd.Flags().Bool("disable-trace", false, "Disable showing traces in logs")
+	cmd.Flags().Duration("shutdown-timeout", 25*time.Second, "Maximum time waited for in-flight scrapes and pending work to complete on shutdown")
+
+	cmd.Flags().String("metrics-port", defaultConfig.Outputs.Prometheus.Port, "Port where metrics web-server will run")
+	cmd.Flags().String("metrics-host", defaultConfig.Outputs.Prometheus.Host, "Host where metrics web-server will run")
+	cmd.Flags().String("metrics-tls-cert-file", "", "Path to the TLS certificate of metrics web-server. It is reloaded when it changes")
+	cmd.Flags().String("metrics-tls-key-file", "", "Path to the TLS key of metrics web-server. It is reloaded when it changes")
+	cmd.Flags().String("metrics-tls-client-ca-file", "", "Path to the CA certificates that client certificates must be signed by (mTLS)")
+	cmd.Flags().String("metrics-auth", defaultConfig.Outputs.Prometheus.Auth, "Authentication required to request metrics: none or kubernetes (TokenReview and SubjectAccessReview)")
 
-	cmd.Flags().String("metrics-port", "2112", "Port where metrics web-server will run")
-	cmd.Flags().String("metrics-host", "0.0.0.0", "Host where metrics web-server will run")
+	cmd.Flags().String("otlp-endpoint", "", "Endpoint of the OTLP receiver where metrics are pushed, as 'host:port'. Empty means they are not pushed")
+	cmd.Flags().String("otlp-protocol", defaultConfig.Outputs.OTLP.Protocol, "Protocol used to push metrics to the OTLP receiver: grpc or http")
+	cmd.Flags().Bool("otlp-insecure", false, "Disable TLS on the connection to the OTLP receiver")
+	cmd.Flags().Bool("otlp-metrics", defaultConfig.Outputs.OTLP.Metrics, "Push metrics of the runs to the OTLP receiver")
+	cmd.Flags().Bool("otlp-traces", defaultConfig.Outputs.OTLP.Traces, "Export completed PipelineRuns as traces to the OTLP receiver")
+	cmd.Flags().Duration("otlp-interval", defaultConfig.Outputs.OTLP.Interval, "Interval between pushes of metrics to the OTLP receiver")
+	cmd.Flags().StringToString("otlp-headers", map[string]string{}, "(Repeatable or comma-separated list) Headers sent to the OTLP receiver, as 'key=value'")
+	cmd.Flags().StringToString("otlp-resource-attributes", map[string]string{}, "(Repeatable or comma-separated list) Resource attributes of pushed metrics, as 'key=value'")
 
-	// This flag is directly defined and used by client-go.
-	// It's declared here for documentation purposes only
-	cmd.Flags().String("kubeconfig", "~/.kube/config", "Path to the kubeconfig file")
+	cmd.Flags().String("pushgateway-url", "", "URL of the Pushgateway where metrics are pushed. Empty means they are not pushed")
+	cmd.Flags().String("pushgateway-job", defaultConfig.Outputs.Pushgateway.Job, "Value of the 'job' label of the groups pushed to the Pushgateway")
+	cmd.Flags().Duration("pushgateway-interval", defaultConfig.Outputs.Pushgateway.Interval, "Interval between pushes of metrics to the Pushgateway")
+	cmd.Flags().StringToString("pushgateway-grouping", map[string]string{}, "(Repeatable or comma-separated list) Static labels added to the grouping key of the groups pushed to the Pushgateway, as 'key=value'")
+
+	cmd.Flags().String("remote-write-url", "", "URL of the Prometheus remote-write receiver where metrics are written. Empty means they are not written")
+	cmd.Flags().Duration("remote-write-interval", defaultConfig.Outputs.RemoteWrite.Interval, "Interval between samples of the metrics written to the remote-write receiver")
+	cmd.Flags().StringToString("remote-write-external-labels", map[string]string{}, "(Repeatable or comma-separated list) Labels added to all the series written to the remote-write receiver, as 'key=value'")
+	cmd.Flags().StringToString("remote-write-headers", map[string]string{}, "(Repeatable or comma-separated list) Headers sent to the remote-write receiver, as 'key=value'")
+	cmd.Flags().Int("remote-write-shards", defaultConfig.Outputs.RemoteWrite.Queue.Shards, "Amount of concurrent senders of samples to the remote-write receiver")
+
+	cmd.Flags().String("statsd-address", "", "Address of the StatsD server where metrics of completed runs are emitted, as 'host:port'. Empty means they are not emitted")
+	cmd.Flags().String("statsd-flavor", defaultConfig.Outputs.StatsD.Flavor, "Flavor of the protocol used to emit metrics to the StatsD server: statsd or dogstatsd")
+	cmd.Flags().String("statsd-prefix", defaultConfig.Outputs.StatsD.Prefix, "Prefix of the names of the metrics emitted to the StatsD server")
+	cmd.Flags().StringToString("statsd-tags", map[string]string{}, "(Repeatable or comma-separated list) Static tags added to the metrics emitted to the StatsD server, as 'key=value'")
+
+	cmd.Flags().String("event-log-sink", defaultConfig.Outputs.EventLog.Sink, "Sink where a JSON line is written per completed run: none, stdout, file or http")
+	cmd.Flags().String("event-log-file", "", "Path of the file where run completions are written with file sink. It is rotated when it reaches its maximum size")
+	cmd.Flags().String("event-log-url", "", "URL of the HTTP endpoint where run completions are posted as newline-delimited JSON with http sink")
+
+	cmd.Flags().String("cloudevents-sink", "", "URL where CloudEvents are sent when runs start, succeed, fail or are cancelled. Empty means they are only sent for namespaces with their own sink")
+	cmd.Flags().StringToString("cloudevents-namespace-sinks", map[string]string{}, "(Repeatable or comma-separated list) URLs where CloudEvents of the runs in each namespace are sent instead, as 'namespace=url'")
+	cmd.Flags().String("cloudevents-mode", defaultConfig.Outputs.CloudEvents.Mode, "Content mode of the CloudEvents: binary or structured")
+
+	cmd.Flags().Bool("leader-election", false, "Enable leader election, so only one replica exports metrics of the runs")
+	cmd.Flags().String("leader-election-lease-name", defaultConfig.LeaderElection.LeaseName, "Name of the Lease used for leader election")
+	cmd.Flags().String("leader-election-namespace", "", "Namespace of the Lease used for leader election. Defaults to the namespace of the pod")
+
+	// This flag is read by controller-runtime from the standard flag set, so it is passed there once parsed
+	cmd.Flags().String("kubeconfig", "", "Path to the kubeconfig file. Defaults to KUBECONFIG environment variable, '~/.kube/config' or the in-cluster configuration")
+
+	cmd.Flags().Duration("watcher-backoff-initial-interval", defaultConfig.Watch.Backoff.InitialInterval, "Time waited before restarting a watcher after its first consecutive failure")
+	cmd.Flags().Duration("watcher-backoff-max-interval", defaultConfig.Watch.Backoff.MaxInterval, "Maximum time waited before restarting a failed watcher")
+
+	cmd.Flags().Int("shard-index", defaultConfig.Watch.Shard.Index, "Index of the shard of runs exported by this replica. Negative means it is taken from the StatefulSet ordinal")
+	cmd.Flags().Int("shard-count", defaultConfig.Watch.Shard.Count, "Amount of shards runs are split into, one per replica. One means runs are not sharded")
+	cmd.Flags().String("shard-key", defaultConfig.Watch.Shard.Key, "Field of the runs used to assign them to shards: namespace or uid")
 
 	cmd.Flags().StringSlice("populated-labels", []string{}, "(Repeatable or comma-separated list) Object labels populated on metrics")
+	cmd.Flags().String("populated-labels-placement", defaultConfig.Labels.Placement, "Metrics where populated labels are placed: info, series or both")
+	cmd.Flags().Duration("completed-runs-ttl", defaultConfig.Metrics.CompletedRunsTTL, "Time completed runs are exposed after their completion. Zero means until they are deleted")
+	cmd.Flags().Int("flakiness-window-size", defaultConfig.Metrics.Flakiness.WindowSize, "Amount of latest completed runs considered to compute flakiness")
+
+	cmd.Flags().String("deployment-label-selector", "", "Label selector to mark PipelineRuns as deployments for DORA metrics")
+	cmd.Flags().String("deployment-annotation-selector", "", "Annotation selector to mark PipelineRuns as deployments for DORA metrics")
+	cmd.Flags().String("deployment-service-label", defaultConfig.Metrics.Dora.ServiceLabel, "PipelineRun label containing the name of the deployed service")
+
+	cmd.Flags().StringSlice("git-repository-params", defaultConfig.Metrics.GitInfo.RepositoryParams, "(Repeatable or comma-separated list) PipelineRun params containing the git repository URL")
+	cmd.Flags().StringSlice("git-revision-params", defaultConfig.Metrics.GitInfo.RevisionParams, "(Repeatable or comma-separated list) PipelineRun params containing the git revision")
+	cmd.Flags().StringSlice("git-branch-params", defaultConfig.Metrics.GitInfo.BranchParams, "(Repeatable or comma-separated list) PipelineRun params containing the git branch")
 
 	return cmd
 }
@@ -58,6 +227,17 @@ func NewCommand() *cobra.Command {
 // Ref: https://pkg.go.dev/github.com/spf13/pflag#StringSlice
 func RunCommand(cmd *cobra.Command, args []string) {
 
+	// Set flags from environment variables, so the rest of the process is not aware of them
+	err := bindEnvironment(cmd)
+	if err != nil {
+		log.Fatalf(EnvironmentErrorMessage, err)
+	}
+
+	err = applyKubeconfigFlag(cmd)
+	if err != nil {
+		log.Fatalf(KubeconfigFlagErrorMessage, err)
+	}
+
 	// Init the logger
 	logLevelFlag, err := cmd.Flags().GetString("log-level")
 	if err != nil {
@@ -74,67 +254,393 @@ func RunCommand(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 	}
 
-	// TODO
-	metricsPortFlag, err := cmd.Flags().GetString("metrics-port")
+	shutdownTimeoutFlag, err := cmd.Flags().GetDuration("shutdown-timeout")
+	if err != nil {
+		log.Fatalf(ShutdownTimeoutFlagErrorMessage, err)
+	}
+
+	// Cancel the context of the whole execution on SIGINT or SIGTERM, so everything started from it stops
+	ctx, stopSignals := signal.NotifyContext(globals.ExecContext.Context, syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	globals.ExecContext.Context = ctx
+
+	// Wait for background work (i.e. watchers) on shutdown
+	var workers sync.WaitGroup
+
+	// Load the configuration from the file (when defined), overridden by the flags set by the user
+	configFlag, err := cmd.Flags().GetString("config")
 	if err != nil {
-		log.Fatalf(MetricsPortFlagErrorMessage, err)
+		log.Fatalf(ConfigFlagErrorMessage, err)
 	}
 
-	metricsHostFlag, err := cmd.Flags().GetString("metrics-host")
+	loadConfig := func() (*config.Config, error) {
+		return getConfig(cmd, configFlag)
+	}
+
+	currentConfig, err := loadConfig()
 	if err != nil {
-		log.Fatalf(MetricsHostFlagErrorMessage, err)
+		log.Fatalf(ConfigLoadErrorMessage, err)
 	}
+	config.SetCurrent(currentConfig)
+	globals.ExecContext.Logger.Debugf(ConfigEffectiveMessage, currentConfig)
+
+	// Register a collector into Prometheus Registry.
+	// It renders metrics at scrape time from the runs kept in the store
+	runStore := store.NewStore(currentConfig.Metrics.CompletedRunsTTL)
+	collector := metrics.NewCollector(runStore, getCollectorOptions(currentConfig))
 
-	populatedLabelsFlag, err := cmd.Flags().GetStringSlice("populated-labels")
+	runsRegistry, err := metrics.NewRegistry(collector)
 	if err != nil {
-		log.Fatalf(PopulatedLabelsFlagErrorMessage, err)
+		log.Fatal(err)
 	}
 
-	// Handle a potentially confusing situation:
-	// Cobra flags' library does not properly parse
-	// comma-separated lists depending on the environment
-	// the CLI is running (i.e. Kubernetes),
-	populatedLabelsFlag = globals.SplitCommaSeparatedValues(populatedLabelsFlag)
+	// Reload the configuration each time the file changes.
+	// Stored runs and aggregated outcomes are kept, so only the metrics affected by the changes are altered
+	if configFlag != "" {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			err := config.WatchFile(globals.ExecContext.Context, configFlag, loadConfig, func(newConfig *config.Config) {
+				err := reloadConfig(newConfig, runStore, runsRegistry)
+				if err != nil {
+					globals.ExecContext.Logger.Errorf(ConfigReloadErrorMessage, err)
+				}
+			})
+			if err != nil {
+				globals.ExecContext.Logger.Errorf(ConfigWatcherErrorMessage, err)
+			}
+		}()
+	}
+
+	// Create a Kubernetes client for Unstructured resources (CRs) for each watched cluster
+	clusters, err := kubernetes.NewClusters(globals.ExecContext.Context, currentConfig.Clusters)
+	if err != nil {
+		log.Fatalf(KubernetesClientErrorMessage, err)
+	}
 
-	// Store populated labels in context to use them later
-	globals.ExecContext.Context = context.WithValue(globals.ExecContext.Context,
-		"flag-populated-labels", populatedLabelsFlag)
+	// Only the leader exports the metrics of the runs, so several replicas don't export the same series.
+	// Followers keep processing runs, so they are ready to take over at any moment
+	metrics.RegisterExporterMetrics(prometheus.DefaultRegisterer, runStore)
+	metrics.Leader.Set(1)
 
-	// Register metrics into Prometheus Registry
-	metrics.RegisterMetrics(populatedLabelsFlag)
+	leaderElectionConfig := currentConfig.LeaderElection
+	if leaderElectionConfig.Enabled {
+		runsRegistry.SetEnabled(false)
+		kubernetes.SetRunHandlersEnabled(false)
+		metrics.Leader.Set(0)
 
-	// Create a Kubernetes client for Unstructured resources (CRs)
-	client, err := kubernetes.NewClient()
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			err := kubernetes.RunLeaderElection(globals.ExecContext.Context, kubernetes.LeaderElectionOptions{
+				LeaseName:      leaderElectionConfig.LeaseName,
+				LeaseNamespace: leaderElectionConfig.Namespace,
+				OnLeadershipChange: func(isLeader bool) {
+					runsRegistry.SetEnabled(isLeader)
+					kubernetes.SetRunHandlersEnabled(isLeader)
 
-	// Process PipelineRun resources in the background
-	// Hey!, errors for watcher must be shown inside the watcher as this is a goroutine
-	go func() {
-		// Following loop grants re-launching the goroutine when it fails
-		for {
-			err := kubernetes.WatchPipelineRuns(&globals.ExecContext.Context, client)
+					// The gauge is set once, so scrapes never see a leader as a follower in between
+					leaderValue := 0.0
+					if isLeader {
+						leaderValue = 1
+					}
+					metrics.Leader.Set(leaderValue)
+				},
+			})
+			if err != nil {
+				globals.ExecContext.Logger.Fatalf(LeaderElectionErrorMessage, err)
+			}
+		}()
+	}
+
+	// Push the metrics of the runs to an OTLP receiver too, when defined.
+	// Followers of leader election push nothing, as their registry is disabled
+	otlpConfig := currentConfig.Outputs.OTLP
+	if otlpConfig.Endpoint != "" && otlpConfig.Metrics {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			err := otlp.RunMetricsExporter(globals.ExecContext.Context, runsRegistry, otlpConfig)
 			if err != nil {
-				globals.ExecContext.Logger.Errorf("error on PipelineRun objects watcher: %s", err)
+				globals.ExecContext.Logger.Errorf(OTLPExporterErrorMessage, err)
 			}
+		}()
+	}
+
+	// Export completed PipelineRuns as traces, getting their TaskRuns from the cluster they come from
+	if otlpConfig.Endpoint != "" && otlpConfig.Traces {
+		tracesExporter, err := otlp.NewTracesExporter(globals.ExecContext.Context, clusters, otlpConfig)
+		if err != nil {
+			log.Fatalf(OTLPTracesExporterErrorMessage, err)
 		}
-	}()
+		kubernetes.RegisterRunHandler(tracesExporter)
 
-	// Process TaskRun resources in the background
-	// Hey, errors for watcher must be shown inside the watcher as this is a goroutine
-	go func() {
-		// Following loop grants re-launching the goroutine when it fails
-		for {
-			err := kubernetes.WatchTaskRuns(&globals.ExecContext.Context, client)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			err := tracesExporter.Run(globals.ExecContext.Context)
+			if err != nil {
+				globals.ExecContext.Logger.Errorf(OTLPTracesExporterErrorMessage, err)
+			}
+		}()
+	}
+
+	// Push the metrics of the runs to a Pushgateway, when defined (i.e. for clusters that can not be scraped)
+	if currentConfig.Outputs.Pushgateway.URL != "" {
+		pusher := pushgateway.NewPusher(runsRegistry, currentConfig.Outputs.Pushgateway)
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			pusher.Run(globals.ExecContext.Context)
+		}()
+	}
+
+	// Write the metrics of the runs to a Prometheus remote-write receiver, when defined (i.e. Mimir or Thanos Receive)
+	if currentConfig.Outputs.RemoteWrite.URL != "" {
+		writer := remotewrite.NewWriter(runsRegistry, currentConfig.Outputs.RemoteWrite)
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			writer.Run(globals.ExecContext.Context)
+		}()
+	}
+
+	// Emit metrics of completed runs to a StatsD server, when defined (i.e. a Datadog agent)
+	if currentConfig.Outputs.StatsD.Address != "" {
+		emitter, err := statsd.NewEmitter(collector, currentConfig.Outputs.StatsD)
+		if err != nil {
+			log.Fatalf(StatsDEmitterErrorMessage, err)
+		}
+		kubernetes.RegisterRunHandler(emitter)
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			emitter.Run(globals.ExecContext.Context)
+		}()
+	}
+
+	// Write a JSON line per completed run, when a sink is defined (i.e. to be loaded into a data warehouse)
+	if currentConfig.Outputs.EventLog.Sink != config.EventLogSinkNone {
+		eventLogWriter, err := eventlog.NewWriter(collector, currentConfig.Outputs.EventLog)
+		if err != nil {
+			log.Fatalf(EventLogWriterErrorMessage, err)
+		}
+		kubernetes.RegisterRunHandler(eventLogWriter)
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			eventLogWriter.Run(globals.ExecContext.Context)
+		}()
+	}
+
+	// Emit CloudEvents on the transitions of the runs, when there are sinks for them (i.e. a Knative broker)
+	cloudEventsConfig := currentConfig.Outputs.CloudEvents
+	if cloudEventsConfig.Sink != "" || len(cloudEventsConfig.NamespaceSinks) > 0 {
+		cloudEventsEmitter := cloudevents.NewEmitter(collector, cloudEventsConfig)
+		kubernetes.RegisterRunHandler(cloudEventsEmitter)
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			cloudEventsEmitter.Run(globals.ExecContext.Context)
+		}()
+	}
+
+	// Keep the state of the watchers to report the health and readiness of the exporter
+	healthChecker := health.NewChecker(health.DefaultUnhealthyTimeout)
+
+	// Process the resources of each kind of run of each cluster in the background.
+	// Watchers are restarted when they finish, backing off when they fail in a loop
+	// Hey!, errors for watcher must be shown inside the watcher as this is a goroutine
+	for _, cluster := range clusters {
+		clusterCtx := kubernetes.WithCluster(globals.ExecContext.Context, cluster.Name)
+
+		for _, runKind := range kubernetes.RunKinds {
+			cluster, runKind := cluster, runKind
+
+			// Watchers are named after the cluster too, so the health of each cluster is reported
+			watcherName := runKind.Kind()
+			if cluster.Name != "" {
+				watcherName = cluster.Name + "/" + runKind.Kind()
+			}
+			watcherStatus := healthChecker.Register(watcherName)
+
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+
+				// Restarts resume the watch from the last resource version seen, instead of listing the runs again
+				var resourceVersion string
+				kubernetes.SuperviseWatcher(clusterCtx, runKind.Kind(), func() error {
+					return kubernetes.WatchRuns(&clusterCtx, cluster.Client, runKind, collector, watcherStatus,
+						&resourceVersion)
+				})
+			}()
+		}
+	}
+
+	// Start a webserver for exposing metrics and health endpoints
+	// Exporter's own metrics (default registry) are served along with the metrics of the runs
+	mux := http.NewServeMux()
+	var metricsHandler http.Handler = promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, runsRegistry}, promhttp.HandlerOpts{}))
+
+	// Health endpoints are never authenticated, so they can be requested by probes
+	if currentConfig.Outputs.Prometheus.Auth == config.AuthKubernetes {
+		authenticator, err := webserver.NewKubernetesAuthenticator()
+		if err != nil {
+			log.Fatalf(MetricsAuthErrorMessage, err)
+		}
+		metricsHandler = authenticator.Middleware(metricsHandler)
+	}
+
+	mux.Handle("/metrics", metricsHandler)
+	mux.HandleFunc("/healthz", healthChecker.HealthzHandler)
+	mux.HandleFunc("/readyz", healthChecker.ReadyzHandler)
+
+	server := &http.Server{
+		Addr:    currentConfig.Outputs.Prometheus.Host + ":" + currentConfig.Outputs.Prometheus.Port,
+		Handler: mux,
+	}
+
+	// Serve over TLS when a certificate is defined. It is reloaded when its files change
+	tlsConfig := currentConfig.Outputs.Prometheus.TLS
+	if tlsConfig.CertFile != "" {
+		certificateReloader, err := webserver.NewCertificateReloader(tlsConfig.CertFile, tlsConfig.KeyFile)
+		if err != nil {
+			log.Fatalf(MetricsTLSErrorMessage, err)
+		}
+
+		server.TLSConfig, err = webserver.NewTLSConfig(certificateReloader, tlsConfig.ClientCAFile)
+		if err != nil {
+			log.Fatalf(MetricsTLSErrorMessage, err)
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			err := certificateReloader.Watch(globals.ExecContext.Context)
 			if err != nil {
-				globals.ExecContext.Logger.Errorf("error on TaskRun objects watcher: %s", err)
+				globals.ExecContext.Logger.Errorf(MetricsTLSWatcherErrorMessage, err)
 			}
+		}()
+	}
+
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			globals.ExecContext.Logger.Fatalf(MetricsWebserverErrorMessage, err)
 		}
 	}()
 
-	// Start a webserver for exposing metrics endpoint
-	metricsHost := metricsHostFlag + ":" + metricsPortFlag
-	http.Handle("/metrics", promhttp.Handler())
-	err = http.ListenAndServe(metricsHost, nil)
+	// Wait for a shutdown signal, then drain in-flight work within a bounded period
+	<-ctx.Done()
+	stopSignals()
+	shutdown(server, &workers, shutdownTimeoutFlag)
+}
+
+// shutdown stop the webserver once in-flight requests are completed, and wait for background work to finish.
+// It gives up once the timeout is reached, so the process is not killed by the orchestrator while waiting
+func shutdown(server *http.Server, workers *sync.WaitGroup, timeout time.Duration) {
+	globals.ExecContext.Logger.Infof(ShutdownStartedMessage, timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		globals.ExecContext.Logger.Warn(ShutdownTimeoutMessage)
+		return
+	}
+
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+		globals.ExecContext.Logger.Info(ShutdownCompletedMessage)
+	case <-shutdownCtx.Done():
+		globals.ExecContext.Logger.Warn(ShutdownTimeoutMessage)
+	}
+}
+
+// reloadConfig put a new configuration in use, re-registering the collector with the new set of metrics.
+// The configuration is only published once the collector accepts it, so the previous one is kept on errors
+func reloadConfig(newConfig *config.Config, runStore *store.Store, runsRegistry *metrics.Registry) error {
+	previousConfig := config.Current()
+
+	if !reflect.DeepEqual(newConfig.Outputs, previousConfig.Outputs) {
+		globals.ExecContext.Logger.Warn(ConfigRestartRequiredMessage)
+	}
+
+	// Leader election is kept until restart, as registry and handlers are enabled or disabled by it
+	if !reflect.DeepEqual(newConfig.LeaderElection, previousConfig.LeaderElection) {
+		globals.ExecContext.Logger.Warn(ConfigLeaderElectionRestartRequiredMessage)
+		newConfig.LeaderElection = previousConfig.LeaderElection
+	}
+
+	// Watched clusters are kept until restart, so metrics are coherent with them
+	if !reflect.DeepEqual(newConfig.Clusters, previousConfig.Clusters) {
+		globals.ExecContext.Logger.Warn(ConfigClustersRestartRequiredMessage)
+		newConfig.Clusters = previousConfig.Clusters
+	}
+
+	// Kept fields must be coherent with the new ones (i.e. leader election with sharding)
+	err := newConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = runsRegistry.Reconfigure(getCollectorOptions(newConfig))
 	if err != nil {
-		globals.ExecContext.Logger.Fatalf(MetricsWebserverErrorMessage, err)
+		return fmt.Errorf(ConfigReregisterErrorMessage, err)
+	}
+
+	config.SetCurrent(newConfig)
+	globals.ExecContext.Logger.Debugf(ConfigEffectiveMessage, newConfig)
+
+	// Runs that are out of the new watch scope are not exported anymore
+	runStore.DeleteFunc(func(run *store.Run) bool {
+		return !newConfig.Watch.Matches(run.Namespace, run.UID, run.Labels)
+	})
+
+	// Runs that entered the new watch scope are only processed once they are listed again.
+	// Runs of other shards are discarded before being stored, so the ones of shards taken over are listed too
+	if !slices.Equal(newConfig.Watch.Namespaces, previousConfig.Watch.Namespaces) ||
+		newConfig.Watch.LabelSelector != previousConfig.Watch.LabelSelector ||
+		newConfig.Watch.Shard != previousConfig.Watch.Shard {
+		kubernetes.RequestResync()
+	}
+
+	return nil
+}
+
+// getCollectorOptions return the options of the collector defined by a configuration
+func getCollectorOptions(currentConfig *config.Config) metrics.CollectorOptions {
+	return metrics.CollectorOptions{
+		PopulatedLabels:     currentConfig.Labels.Populated,
+		LabelsPlacement:     currentConfig.Labels.Placement,
+		Relabel:             currentConfig.Labels.Relabel,
+		CompletedRunsTTL:    currentConfig.Metrics.CompletedRunsTTL,
+		RetriesEnabled:      currentConfig.Metrics.Retries.Enabled,
+		FlakinessEnabled:    currentConfig.Metrics.Flakiness.Enabled,
+		DoraEnabled:         currentConfig.Metrics.Dora.Enabled,
+		GitInfoEnabled:      currentConfig.Metrics.GitInfo.Enabled,
+		FlakinessWindowSize: currentConfig.Metrics.Flakiness.WindowSize,
+		RunKinds:            kubernetes.GetRunKindsMetrics(),
+		ClusterLabel:        len(currentConfig.Clusters) > 0,
 	}
 }
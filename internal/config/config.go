@@ -0,0 +1,591 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// redactedValue replaces the secrets of the configuration when it is printed
+	redactedValue = "REDACTED"
+
+	LabelsPlacementInfo   = "info"
+	LabelsPlacementSeries = "series"
+	LabelsPlacementBoth   = "both"
+
+	ShardKeyNamespace = "namespace"
+	ShardKeyUID       = "uid"
+
+	AuthNone       = "none"
+	AuthKubernetes = "kubernetes"
+
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http"
+
+	StatsDFlavorStatsD    = "statsd"
+	StatsDFlavorDogStatsD = "dogstatsd"
+
+	EventLogSinkNone   = "none"
+	EventLogSinkStdout = "stdout"
+	EventLogSinkFile   = "file"
+	EventLogSinkHTTP   = "http"
+
+	CloudEventsModeBinary     = "binary"
+	CloudEventsModeStructured = "structured"
+)
+
+var (
+	// current is the configuration in use. It is replaced as a whole on each reload
+	current atomic.Pointer[Config]
+
+	// prometheusLabelNameRegex is the syntax that label names must follow
+	// Ref: https://prometheus.io/docs/concepts/data_model/#metric-names-and-labels
+	prometheusLabelNameRegex = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+	// invalidLabelNameCharsRegex matches the characters replaced by '_' when object labels are populated on metrics
+	invalidLabelNameCharsRegex = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+	// reservedLabelNames are the labels set by the exporter on its metrics.
+	// Populated labels can not be named like them, as series would have duplicated labels
+	reservedLabelNames = []string{
+		"cluster", "name", "namespace", "uid", "status", "reason", "pipeline", "task", "service",
+		"start_timestamp", "completion_timestamp", "repository", "revision", "branch",
+	}
+)
+
+// NewDefault return a configuration with default values
+func NewDefault() *Config {
+	return &Config{
+		Watch: WatchConfig{
+			Backoff: BackoffConfig{
+				InitialInterval: time.Second,
+				MaxInterval:     5 * time.Minute,
+			},
+			Shard: ShardConfig{
+				Index: -1,
+				Count: 1,
+				Key:   ShardKeyNamespace,
+			},
+		},
+		Labels: LabelsConfig{
+			Populated: []string{},
+			Placement: LabelsPlacementInfo,
+		},
+		Metrics: MetricsConfig{
+			Retries: RetriesMetricsConfig{
+				Enabled: true,
+			},
+			Flakiness: FlakinessMetricsConfig{
+				Enabled:    true,
+				WindowSize: 20,
+			},
+			Dora: DoraMetricsConfig{
+				Enabled:      true,
+				ServiceLabel: "app.kubernetes.io/name",
+			},
+			GitInfo: GitInfoMetricsConfig{
+				Enabled:          true,
+				RepositoryParams: []string{"repo-url", "git-url", "repository", "url"},
+				RevisionParams:   []string{"revision", "git-revision", "commit", "sha"},
+				BranchParams:     []string{"branch", "git-branch", "source-branch"},
+			},
+		},
+		Outputs: OutputsConfig{
+			Prometheus: PrometheusOutputConfig{
+				Host: "0.0.0.0",
+				Port: "2112",
+				Auth: AuthNone,
+			},
+			OTLP: OTLPOutputConfig{
+				Protocol: OTLPProtocolGRPC,
+				Metrics:  true,
+				Interval: 30 * time.Second,
+			},
+			Pushgateway: PushgatewayOutputConfig{
+				Job:      "tekton-exporter",
+				Interval: time.Minute,
+			},
+			RemoteWrite: RemoteWriteOutputConfig{
+				Interval: 30 * time.Second,
+				Queue: RemoteWriteQueueConfig{
+					Shards:            4,
+					Capacity:          10000,
+					MaxSamplesPerSend: 2000,
+					BatchSendDeadline: 5 * time.Second,
+					MinBackoff:        30 * time.Millisecond,
+					MaxBackoff:        5 * time.Second,
+				},
+			},
+			StatsD: StatsDOutputConfig{
+				Flavor:        StatsDFlavorDogStatsD,
+				Prefix:        "tekton_exporter.",
+				FlushInterval: time.Second,
+				MaxPacketSize: 1432,
+			},
+			EventLog: EventLogOutputConfig{
+				Sink: EventLogSinkNone,
+				File: EventLogFileConfig{
+					MaxSizeMB:  100,
+					MaxBackups: 5,
+				},
+				HTTP: EventLogHTTPConfig{
+					MaxBatchSize: 100,
+				},
+			},
+			CloudEvents: CloudEventsOutputConfig{
+				Mode: CloudEventsModeBinary,
+				Queue: CloudEventsQueueConfig{
+					Capacity:    1000,
+					Workers:     4,
+					MaxAttempts: 5,
+					MinBackoff:  time.Second,
+					MaxBackoff:  30 * time.Second,
+				},
+			},
+		},
+		LeaderElection: LeaderElectionConfig{
+			LeaseName: "tekton-exporter",
+		},
+	}
+}
+
+// LoadFile return the configuration defined in a YAML file, on top of default values.
+// Unknown fields are rejected, so typos are not silently ignored
+func LoadFile(path string) (config *Config, err error) {
+	fileContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("impossible to read config file: %w", err)
+	}
+
+	config = NewDefault()
+
+	decoder := yaml.NewDecoder(bytes.NewReader(fileContent))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("impossible to parse config file: %w", err)
+	}
+
+	return config, nil
+}
+
+// Validate check that the values of the configuration are valid,
+// and prepare the parsed values (i.e. selectors, regular expressions) used later
+func (c *Config) Validate() (err error) {
+
+	// Validate clusters
+	clusterNames := make(map[string]bool)
+	for index := range c.Clusters {
+		cluster := &c.Clusters[index]
+
+		if cluster.Name == "" || clusterNames[cluster.Name] {
+			return fmt.Errorf("invalid clusters[%d]: name is required and must be unique", index)
+		}
+		clusterNames[cluster.Name] = true
+
+		if cluster.Secret != nil {
+			if cluster.Kubeconfig != "" {
+				return fmt.Errorf("invalid clusters[%d]: kubeconfig and secret are mutually exclusive", index)
+			}
+
+			if cluster.Secret.Name == "" {
+				return fmt.Errorf("invalid clusters[%d]: secret.name is required", index)
+			}
+
+			if cluster.Secret.Key == "" {
+				cluster.Secret.Key = "kubeconfig"
+			}
+		}
+	}
+
+	// Validate watch scope
+	c.Watch.labelSelector, err = labels.Parse(c.Watch.LabelSelector)
+	if err != nil {
+		return fmt.Errorf("invalid watch.labelSelector: %w", err)
+	}
+
+	if c.Watch.Backoff.InitialInterval <= 0 {
+		return errors.New("invalid watch.backoff.initialInterval: must be greater than zero")
+	}
+
+	if c.Watch.Backoff.MaxInterval < c.Watch.Backoff.InitialInterval {
+		return errors.New("invalid watch.backoff.maxInterval: must not be lower than initialInterval")
+	}
+
+	if c.Watch.Shard.Count < 1 {
+		return errors.New("invalid watch.shard.count: must be greater than zero")
+	}
+
+	if !slices.Contains([]string{ShardKeyNamespace, ShardKeyUID}, c.Watch.Shard.Key) {
+		return fmt.Errorf("invalid watch.shard.key '%s': must be one of namespace or uid", c.Watch.Shard.Key)
+	}
+
+	// Only the leader would export its shard, so the runs of the other shards would never be exported
+	if c.Watch.Shard.Count > 1 && c.LeaderElection.Enabled {
+		return errors.New("invalid watch.shard.count: sharding and leaderElection are mutually exclusive")
+	}
+
+	// Index is only needed when runs are sharded. Negative ones are taken from the ordinal of the pod
+	if c.Watch.Shard.Count > 1 {
+		if c.Watch.Shard.Index < 0 {
+			c.Watch.Shard.Index, err = getStatefulSetOrdinal()
+			if err != nil {
+				return fmt.Errorf("invalid watch.shard.index: %w", err)
+			}
+		}
+
+		if c.Watch.Shard.Index >= c.Watch.Shard.Count {
+			return fmt.Errorf("invalid watch.shard.index %d: must be lower than watch.shard.count", c.Watch.Shard.Index)
+		}
+	}
+
+	// Validate label extraction
+	if !slices.Contains([]string{LabelsPlacementInfo, LabelsPlacementSeries, LabelsPlacementBoth}, c.Labels.Placement) {
+		return fmt.Errorf("invalid labels.placement '%s': must be one of info, series or both", c.Labels.Placement)
+	}
+
+	for index, populatedLabel := range c.Labels.Populated {
+		promLabelName := invalidLabelNameCharsRegex.ReplaceAllString(populatedLabel, "_")
+		if !model.LabelName(promLabelName).IsValid() {
+			return fmt.Errorf("invalid labels.populated[%d]: '%s' is not a valid label name once converted to '%s'", index, populatedLabel, promLabelName)
+		}
+
+		if slices.Contains(reservedLabelNames, promLabelName) {
+			return fmt.Errorf("invalid labels.populated[%d]: '%s' collides with reserved label '%s'", index, populatedLabel, promLabelName)
+		}
+	}
+
+	for index := range c.Labels.Relabel {
+		rule := &c.Labels.Relabel[index]
+
+		if rule.SourceLabel == "" {
+			return fmt.Errorf("invalid labels.relabel[%d]: sourceLabel is required", index)
+		}
+
+		if !prometheusLabelNameRegex.MatchString(rule.TargetLabel) {
+			return fmt.Errorf("invalid labels.relabel[%d]: targetLabel '%s' is not a valid label name", index, rule.TargetLabel)
+		}
+
+		if slices.Contains(reservedLabelNames, rule.TargetLabel) {
+			return fmt.Errorf("invalid labels.relabel[%d]: targetLabel '%s' is a reserved label", index, rule.TargetLabel)
+		}
+
+		if rule.Regex == "" {
+			rule.Regex = "(.*)"
+		}
+
+		if rule.Replacement == "" {
+			rule.Replacement = "$1"
+		}
+
+		// Regular expressions are anchored, as Prometheus does
+		rule.regex, err = regexp.Compile("^(?:" + rule.Regex + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid labels.relabel[%d]: %w", index, err)
+		}
+	}
+
+	// Validate leader election
+	if c.LeaderElection.Enabled && c.LeaderElection.LeaseName == "" {
+		return errors.New("invalid leaderElection.leaseName: must not be empty")
+	}
+
+	// Validate metrics
+	if c.Metrics.CompletedRunsTTL < 0 {
+		return errors.New("invalid metrics.completedRunsTTL: must not be negative")
+	}
+
+	if c.Metrics.Flakiness.WindowSize < 1 {
+		return errors.New("invalid metrics.flakiness.windowSize: must be greater than zero")
+	}
+
+	if c.Metrics.Dora.LabelSelector != "" {
+		c.Metrics.Dora.labelSelector, err = labels.Parse(c.Metrics.Dora.LabelSelector)
+		if err != nil {
+			return fmt.Errorf("invalid metrics.dora.labelSelector: %w", err)
+		}
+	}
+
+	if c.Metrics.Dora.AnnotationSelector != "" {
+		c.Metrics.Dora.annotationSelector, err = labels.Parse(c.Metrics.Dora.AnnotationSelector)
+		if err != nil {
+			return fmt.Errorf("invalid metrics.dora.annotationSelector: %w", err)
+		}
+	}
+
+	// Validate outputs
+	if c.Outputs.Prometheus.Port == "" {
+		return errors.New("invalid outputs.prometheus.port: must not be empty")
+	}
+
+	prometheusTLS := c.Outputs.Prometheus.TLS
+	if (prometheusTLS.CertFile == "") != (prometheusTLS.KeyFile == "") {
+		return errors.New("invalid outputs.prometheus.tls: certFile and keyFile must be defined together")
+	}
+
+	if prometheusTLS.ClientCAFile != "" && prometheusTLS.CertFile == "" {
+		return errors.New("invalid outputs.prometheus.tls.clientCAFile: it requires certFile and keyFile")
+	}
+
+	if !slices.Contains([]string{AuthNone, AuthKubernetes}, c.Outputs.Prometheus.Auth) {
+		return fmt.Errorf("invalid outputs.prometheus.auth '%s': must be one of none or kubernetes", c.Outputs.Prometheus.Auth)
+	}
+
+	if !slices.Contains([]string{OTLPProtocolGRPC, OTLPProtocolHTTP}, c.Outputs.OTLP.Protocol) {
+		return fmt.Errorf("invalid outputs.otlp.protocol '%s': must be one of grpc or http", c.Outputs.OTLP.Protocol)
+	}
+
+	if c.Outputs.OTLP.Interval <= 0 {
+		return errors.New("invalid outputs.otlp.interval: must be greater than zero")
+	}
+
+	if c.Outputs.Pushgateway.Job == "" {
+		return errors.New("invalid outputs.pushgateway.job: must not be empty")
+	}
+
+	if c.Outputs.Pushgateway.Interval <= 0 {
+		return errors.New("invalid outputs.pushgateway.interval: must be greater than zero")
+	}
+
+	remoteWriteConfig := c.Outputs.RemoteWrite
+	if remoteWriteConfig.Interval <= 0 {
+		return errors.New("invalid outputs.remoteWrite.interval: must be greater than zero")
+	}
+
+	if remoteWriteConfig.Queue.Shards <= 0 || remoteWriteConfig.Queue.Capacity <= 0 ||
+		remoteWriteConfig.Queue.MaxSamplesPerSend <= 0 || remoteWriteConfig.Queue.BatchSendDeadline <= 0 {
+		return errors.New("invalid outputs.remoteWrite.queue: shards, capacity, maxSamplesPerSend and batchSendDeadline must be greater than zero")
+	}
+
+	if remoteWriteConfig.Queue.MinBackoff <= 0 || remoteWriteConfig.Queue.MaxBackoff < remoteWriteConfig.Queue.MinBackoff {
+		return errors.New("invalid outputs.remoteWrite.queue: minBackoff must be greater than zero and not greater than maxBackoff")
+	}
+
+	if !slices.Contains([]string{StatsDFlavorStatsD, StatsDFlavorDogStatsD}, c.Outputs.StatsD.Flavor) {
+		return fmt.Errorf("invalid outputs.statsd.flavor '%s': must be one of statsd or dogstatsd", c.Outputs.StatsD.Flavor)
+	}
+
+	if c.Outputs.StatsD.FlushInterval <= 0 {
+		return errors.New("invalid outputs.statsd.flushInterval: must be greater than zero")
+	}
+
+	if c.Outputs.StatsD.MaxPacketSize <= 0 {
+		return errors.New("invalid outputs.statsd.maxPacketSize: must be greater than zero")
+	}
+
+	eventLogConfig := c.Outputs.EventLog
+	if !slices.Contains([]string{EventLogSinkNone, EventLogSinkStdout, EventLogSinkFile, EventLogSinkHTTP}, eventLogConfig.Sink) {
+		return fmt.Errorf("invalid outputs.eventLog.sink '%s': must be one of none, stdout, file or http", eventLogConfig.Sink)
+	}
+
+	if eventLogConfig.Sink == EventLogSinkFile && eventLogConfig.File.Path == "" {
+		return errors.New("invalid outputs.eventLog.file.path: must not be empty with file sink")
+	}
+
+	if eventLogConfig.File.MaxSizeMB <= 0 || eventLogConfig.File.MaxBackups < 0 {
+		return errors.New("invalid outputs.eventLog.file: maxSizeMB must be greater than zero and maxBackups must not be negative")
+	}
+
+	if eventLogConfig.Sink == EventLogSinkHTTP && eventLogConfig.HTTP.URL == "" {
+		return errors.New("invalid outputs.eventLog.http.url: must not be empty with http sink")
+	}
+
+	if eventLogConfig.HTTP.MaxBatchSize <= 0 {
+		return errors.New("invalid outputs.eventLog.http.maxBatchSize: must be greater than zero")
+	}
+
+	cloudEventsConfig := c.Outputs.CloudEvents
+	if !slices.Contains([]string{CloudEventsModeBinary, CloudEventsModeStructured}, cloudEventsConfig.Mode) {
+		return fmt.Errorf("invalid outputs.cloudEvents.mode '%s': must be one of binary or structured", cloudEventsConfig.Mode)
+	}
+
+	if cloudEventsConfig.Queue.Capacity <= 0 || cloudEventsConfig.Queue.Workers <= 0 || cloudEventsConfig.Queue.MaxAttempts <= 0 {
+		return errors.New("invalid outputs.cloudEvents.queue: capacity, workers and maxAttempts must be greater than zero")
+	}
+
+	if cloudEventsConfig.Queue.MinBackoff <= 0 || cloudEventsConfig.Queue.MaxBackoff < cloudEventsConfig.Queue.MinBackoff {
+		return errors.New("invalid outputs.cloudEvents.queue: minBackoff must be greater than zero and not greater than maxBackoff")
+	}
+
+	return nil
+}
+
+// Matches return true when a run with the given namespace, uid and labels is inside the watch scope
+func (w *WatchConfig) Matches(namespace, uid string, objectLabels map[string]string) bool {
+	if !w.Shard.Owns(namespace, uid) {
+		return false
+	}
+
+	if len(w.Namespaces) > 0 && !slices.Contains(w.Namespaces, namespace) {
+		return false
+	}
+
+	return w.labelSelector == nil || w.labelSelector.Matches(labels.Set(objectLabels))
+}
+
+// Owns return true when a run with the given namespace and uid belongs to the shard of this replica
+func (s *ShardConfig) Owns(namespace, uid string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+
+	key := namespace
+	if s.Key == ShardKeyUID {
+		key = uid
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+
+	return getJumpHash(hash.Sum64(), s.Count) == s.Index
+}
+
+// getJumpHash return the bucket, between 0 and buckets-1, assigned to a key by Jump Consistent Hash.
+// When the amount of buckets changes, only the minimum amount of keys is moved to other buckets
+// Ref: https://arxiv.org/abs/1406.2294
+func getJumpHash(key uint64, buckets int) int {
+	var bucket, next int64 = -1, 0
+	for next < int64(buckets) {
+		bucket = next
+		key = key*2862933555777941757 + 1
+		next = int64(float64(bucket+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(bucket)
+}
+
+// getStatefulSetOrdinal return the ordinal of the pod in a StatefulSet, taken from the suffix of its hostname
+func getStatefulSetOrdinal() (ordinal int, err error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+
+	separatorIndex := strings.LastIndex(hostname, "-")
+	ordinal, err = strconv.Atoi(hostname[separatorIndex+1:])
+	if separatorIndex == -1 || err != nil || ordinal < 0 {
+		return 0, fmt.Errorf("impossible to get StatefulSet ordinal from hostname '%s'", hostname)
+	}
+
+	return ordinal, nil
+}
+
+// Apply return the value crafted by the rule from the object labels, and whether the regex matched
+func (r *RelabelConfig) Apply(objectLabels map[string]string) (value string, matched bool) {
+	sourceValue, found := objectLabels[r.SourceLabel]
+	if !found || r.regex == nil {
+		return "", false
+	}
+
+	match := r.regex.FindStringSubmatchIndex(sourceValue)
+	if match == nil {
+		return "", false
+	}
+
+	return string(r.regex.ExpandString(nil, r.Replacement, sourceValue, match)), true
+}
+
+// IsDeployment return true when a PipelineRun with the given labels and annotations is a deployment
+func (d *DoraMetricsConfig) IsDeployment(objectLabels, objectAnnotations map[string]string) bool {
+	if d.labelSelector == nil && d.annotationSelector == nil {
+		return false
+	}
+
+	if d.labelSelector != nil && !d.labelSelector.Matches(labels.Set(objectLabels)) {
+		return false
+	}
+
+	if d.annotationSelector != nil && !d.annotationSelector.Matches(labels.Set(objectAnnotations)) {
+		return false
+	}
+
+	return true
+}
+
+// String return the configuration expressed in YAML, as it is written in the configuration file.
+// Secrets are redacted, as it is intended to be logged
+func (c *Config) String() string {
+	content, err := yaml.Marshal(c.redacted())
+	if err != nil {
+		return fmt.Sprintf("impossible to marshal configuration: %v", err)
+	}
+	return string(content)
+}
+
+// redacted return a copy of the configuration without secrets: values of the headers sent to outputs
+// (i.e. 'Authorization') and passwords of the URLs
+func (c *Config) redacted() *Config {
+	redacted := *c
+	outputs := &redacted.Outputs
+
+	outputs.OTLP.Headers = redactHeaders(outputs.OTLP.Headers)
+	outputs.RemoteWrite.Headers = redactHeaders(outputs.RemoteWrite.Headers)
+	outputs.EventLog.HTTP.Headers = redactHeaders(outputs.EventLog.HTTP.Headers)
+
+	outputs.Pushgateway.URL = redactURL(outputs.Pushgateway.URL)
+	outputs.RemoteWrite.URL = redactURL(outputs.RemoteWrite.URL)
+	outputs.EventLog.HTTP.URL = redactURL(outputs.EventLog.HTTP.URL)
+	outputs.CloudEvents.Sink = redactURL(outputs.CloudEvents.Sink)
+
+	if outputs.CloudEvents.NamespaceSinks != nil {
+		namespaceSinks := make(map[string]string, len(outputs.CloudEvents.NamespaceSinks))
+		for namespace, sink := range outputs.CloudEvents.NamespaceSinks {
+			namespaceSinks[namespace] = redactURL(sink)
+		}
+		outputs.CloudEvents.NamespaceSinks = namespaceSinks
+	}
+
+	return &redacted
+}
+
+// redactHeaders return a copy of the headers whose values are redacted
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+
+	redactedHeaders := make(map[string]string, len(headers))
+	for headerName := range headers {
+		redactedHeaders[headerName] = redactedValue
+	}
+	return redactedHeaders
+}
+
+// redactURL return the URL with its password redacted, when it has one
+func redactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsedURL.Redacted()
+}
+
+// Current return the configuration in use
+func Current() *Config {
+	config := current.Load()
+	if config == nil {
+		config = NewDefault()
+		_ = config.Validate()
+	}
+	return config
+}
+
+// SetCurrent replace the configuration in use. It must be already validated
+func SetCurrent(config *Config) {
+	current.Store(config)
+}
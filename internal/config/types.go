@@ -0,0 +1,380 @@
+package config
+
+import (
+	"regexp"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Config represents the whole configuration of the exporter.
+// It can be defined in a YAML file, and its fields can be overridden by flags
+type Config struct {
+	// Clusters whose runs are exported. Empty means only the cluster where the exporter is running (or the current
+	// context of the kubeconfig). Changes on it require a restart
+	Clusters []ClusterConfig `yaml:"clusters"`
+
+	Watch   WatchConfig   `yaml:"watch"`
+	Labels  LabelsConfig  `yaml:"labels"`
+	Metrics MetricsConfig `yaml:"metrics"`
+	Outputs OutputsConfig `yaml:"outputs"`
+
+	LeaderElection LeaderElectionConfig `yaml:"leaderElection"`
+}
+
+// ClusterConfig represents a Kubernetes cluster whose runs are exported
+type ClusterConfig struct {
+	// Name of the cluster, exposed in the 'cluster' label of the metrics
+	Name string `yaml:"name"`
+
+	// Kubeconfig is the path to the kubeconfig file to connect to the cluster.
+	// Empty means default loading rules (i.e. KUBECONFIG environment variable)
+	Kubeconfig string `yaml:"kubeconfig"`
+
+	// Secret is a Secret in the cluster where the exporter is running that contains the kubeconfig.
+	// It is mutually exclusive with Kubeconfig
+	Secret *SecretKeyConfig `yaml:"secret"`
+
+	// Context of the kubeconfig used to connect to the cluster. Empty means the current context
+	Context string `yaml:"context"`
+}
+
+// SecretKeyConfig represents a key of a Secret
+type SecretKeyConfig struct {
+	// Namespace of the Secret. Empty means the namespace where the exporter is running
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+
+	// Key of the Secret containing the value. Defaults to 'kubeconfig'
+	Key string `yaml:"key"`
+}
+
+// LeaderElectionConfig represents the election of the replica that exports the metrics of the runs.
+// Changes on it require a restart
+type LeaderElectionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// LeaseName is the name of the Lease used for the election
+	LeaseName string `yaml:"leaseName"`
+
+	// Namespace of the Lease. Empty means the namespace where the exporter is running
+	Namespace string `yaml:"namespace"`
+}
+
+// WatchConfig represents the scope of the runs that are exported
+type WatchConfig struct {
+	// Namespaces where runs are exported from. Empty means all of them
+	Namespaces []string `yaml:"namespaces"`
+
+	// LabelSelector that runs must match to be exported. Empty means all of them
+	LabelSelector string `yaml:"labelSelector"`
+
+	// Backoff defines the time waited before restarting a failed watcher
+	Backoff BackoffConfig `yaml:"backoff"`
+
+	// Shard defines the portion of the runs exported by this replica, when runs are split across several of them
+	Shard ShardConfig `yaml:"shard"`
+
+	labelSelector labels.Selector
+}
+
+// ShardConfig represents the portion of the runs exported by a replica.
+// Runs are assigned to shards by a consistent hash of their key, so each run is exported by only one replica
+type ShardConfig struct {
+	// Index of the shard exported by this replica, from 0 to Count-1.
+	// A negative value means it is taken from the ordinal of the pod in a StatefulSet (i.e. 'tekton-exporter-2')
+	Index int `yaml:"index"`
+
+	// Count is the amount of shards. One means runs are not sharded
+	Count int `yaml:"count"`
+
+	// Key is the field of the runs used to assign them to shards: 'namespace' or 'uid'
+	Key string `yaml:"key"`
+}
+
+// BackoffConfig represents an exponential backoff with jitter.
+// Interval starts at InitialInterval and is doubled on each consecutive failure, up to MaxInterval
+type BackoffConfig struct {
+	InitialInterval time.Duration `yaml:"initialInterval"`
+	MaxInterval     time.Duration `yaml:"maxInterval"`
+}
+
+// LabelsConfig represents how object labels are extracted into metrics
+type LabelsConfig struct {
+	// Populated are the object labels populated on metrics
+	Populated []string `yaml:"populated"`
+
+	// Placement defines the metrics where populated labels are placed: info, series or both
+	Placement string `yaml:"placement"`
+
+	// Relabel are rules to craft extra labels from the values of object labels
+	Relabel []RelabelConfig `yaml:"relabel"`
+}
+
+// RelabelConfig represents a rule to craft a label from the value of an object label
+type RelabelConfig struct {
+	// SourceLabel is the object label whose value is used
+	SourceLabel string `yaml:"sourceLabel"`
+
+	// TargetLabel is the name of the crafted label, in Prometheus syntax
+	TargetLabel string `yaml:"targetLabel"`
+
+	// Regex is matched against the value of the source label. Defaults to '(.*)'
+	Regex string `yaml:"regex"`
+
+	// Replacement is the value of the target label when regex matches. Defaults to '$1'
+	Replacement string `yaml:"replacement"`
+
+	regex *regexp.Regexp
+}
+
+// MetricsConfig represents the metrics exposed by the exporter
+type MetricsConfig struct {
+	// CompletedRunsTTL is the time completed runs are exposed after their completion. Zero means forever
+	CompletedRunsTTL time.Duration `yaml:"completedRunsTTL"`
+
+	Retries   RetriesMetricsConfig   `yaml:"retries"`
+	Flakiness FlakinessMetricsConfig `yaml:"flakiness"`
+	Dora      DoraMetricsConfig      `yaml:"dora"`
+	GitInfo   GitInfoMetricsConfig   `yaml:"gitInfo"`
+}
+
+// RetriesMetricsConfig represents the metrics about retried TaskRuns
+type RetriesMetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// FlakinessMetricsConfig represents the metrics about the flakiness of pipelines and tasks
+type FlakinessMetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// WindowSize is the amount of latest completed runs considered to compute flakiness
+	WindowSize int `yaml:"windowSize"`
+}
+
+// DoraMetricsConfig represents DORA metrics computed from deployment PipelineRuns
+type DoraMetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// LabelSelector and AnnotationSelector mark PipelineRuns as deployments.
+	// All the defined selectors must match. When none is defined, no run is a deployment
+	LabelSelector      string `yaml:"labelSelector"`
+	AnnotationSelector string `yaml:"annotationSelector"`
+
+	// ServiceLabel is the PipelineRun label containing the name of the deployed service
+	ServiceLabel string `yaml:"serviceLabel"`
+
+	labelSelector      labels.Selector
+	annotationSelector labels.Selector
+}
+
+// GitInfoMetricsConfig represents the metrics about the git information of PipelineRuns
+type GitInfoMetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// RepositoryParams, RevisionParams and BranchParams are the PipelineRun params containing git information
+	RepositoryParams []string `yaml:"repositoryParams"`
+	RevisionParams   []string `yaml:"revisionParams"`
+	BranchParams     []string `yaml:"branchParams"`
+}
+
+// OutputsConfig represents the places where metrics are sent to
+type OutputsConfig struct {
+	Prometheus  PrometheusOutputConfig  `yaml:"prometheus"`
+	OTLP        OTLPOutputConfig        `yaml:"otlp"`
+	Pushgateway PushgatewayOutputConfig `yaml:"pushgateway"`
+	RemoteWrite RemoteWriteOutputConfig `yaml:"remoteWrite"`
+	StatsD      StatsDOutputConfig      `yaml:"statsd"`
+	EventLog    EventLogOutputConfig    `yaml:"eventLog"`
+	CloudEvents CloudEventsOutputConfig `yaml:"cloudEvents"`
+}
+
+// PrometheusOutputConfig represents the web-server where metrics are exposed to be scraped.
+// Changes on it require a restart
+type PrometheusOutputConfig struct {
+	Host string `yaml:"host"`
+	Port string `yaml:"port"`
+
+	TLS TLSConfig `yaml:"tls"`
+
+	// Auth is the authentication required to request the metrics: 'none' or 'kubernetes'.
+	// Kubernetes one authenticates bearer tokens by TokenReview, and authorizes them by SubjectAccessReview
+	Auth string `yaml:"auth"`
+}
+
+// TLSConfig represents the TLS configuration of a webserver.
+// Certificates are reloaded when their files change
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// ClientCAFile enables mTLS, requiring clients to present a certificate signed by one of its CAs
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// OTLPOutputConfig represents the push of metrics and traces to an OpenTelemetry receiver (i.e. OpenTelemetry Collector).
+// Standard OTEL_EXPORTER_OTLP_* and OTEL_RESOURCE_ATTRIBUTES environment variables are honored too
+type OTLPOutputConfig struct {
+	// Endpoint of the receiver as 'host:port'. Empty means nothing is pushed
+	Endpoint string `yaml:"endpoint"`
+
+	// Protocol used to push the metrics: 'grpc' or 'http'
+	Protocol string `yaml:"protocol"`
+
+	// Insecure disables TLS on the connection to the receiver
+	Insecure bool `yaml:"insecure"`
+
+	// Headers sent on each push (i.e. authentication ones)
+	Headers map[string]string `yaml:"headers"`
+
+	// Metrics enables pushing the metrics of the runs every Interval
+	Metrics  bool          `yaml:"metrics"`
+	Interval time.Duration `yaml:"interval"`
+
+	// Traces enables exporting completed PipelineRuns as traces: the PipelineRun is the root span,
+	// its TaskRuns are child spans and their steps are grandchild spans
+	Traces bool `yaml:"traces"`
+
+	// ResourceAttributes identify the exporter on the receiver side (i.e. 'k8s.cluster.name').
+	// They are added to 'service.name' and 'service.instance.id', which are always defined
+	ResourceAttributes map[string]string `yaml:"resourceAttributes"`
+}
+
+// PushgatewayOutputConfig represents the push of the metrics to a Prometheus Pushgateway.
+// Metrics are pushed in a group per cluster and namespace, so groups of deleted runs are deleted too
+type PushgatewayOutputConfig struct {
+	// URL of the Pushgateway (i.e. 'http://pushgateway:9091'). Empty means metrics are not pushed
+	URL string `yaml:"url"`
+
+	// Job is the value of the 'job' label of the groups
+	Job string `yaml:"job"`
+
+	// Interval between pushes
+	Interval time.Duration `yaml:"interval"`
+
+	// Grouping are static labels added to the grouping key of all the groups (i.e. 'cluster' in single-cluster mode)
+	Grouping map[string]string `yaml:"grouping"`
+}
+
+// RemoteWriteOutputConfig represents the write of the metrics to a Prometheus remote-write v1 receiver
+// (i.e. Mimir, Thanos Receive or Prometheus itself)
+type RemoteWriteOutputConfig struct {
+	// URL of the receiver (i.e. 'http://mimir:8080/api/v1/push'). Empty means metrics are not written
+	URL string `yaml:"url"`
+
+	// Interval between samples of the metrics, like a scrape interval
+	Interval time.Duration `yaml:"interval"`
+
+	// ExternalLabels are added to all the series, unless they already have a label with the same name
+	ExternalLabels map[string]string `yaml:"externalLabels"`
+
+	// Headers sent on each request (i.e. 'X-Scope-OrgID' or 'Authorization')
+	Headers map[string]string `yaml:"headers"`
+
+	Queue RemoteWriteQueueConfig `yaml:"queue"`
+}
+
+// RemoteWriteQueueConfig represents the in-memory queue of samples waiting to be written.
+// Samples are split in shards by series, and each shard sends its samples in order, retrying failed requests
+type RemoteWriteQueueConfig struct {
+	// Shards is the amount of concurrent senders
+	Shards int `yaml:"shards"`
+
+	// Capacity is the amount of samples queued on each shard. When it is full, new samples are discarded
+	Capacity int `yaml:"capacity"`
+
+	// MaxSamplesPerSend is the maximum amount of samples sent on each request
+	MaxSamplesPerSend int `yaml:"maxSamplesPerSend"`
+
+	// BatchSendDeadline is the maximum time samples wait in a shard before being sent
+	BatchSendDeadline time.Duration `yaml:"batchSendDeadline"`
+
+	// MinBackoff and MaxBackoff bound the time waited between retries of a failed request
+	MinBackoff time.Duration `yaml:"minBackoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+// StatsDOutputConfig represents the emission of metrics about completed runs to a StatsD or DogStatsD server by UDP
+// (i.e. a Datadog agent)
+type StatsDOutputConfig struct {
+	// Address of the server as 'host:port'. Empty means nothing is emitted
+	Address string `yaml:"address"`
+
+	// Flavor of the protocol: 'statsd' or 'dogstatsd'. Plain StatsD has no tags nor distributions,
+	// so the dimensions of the runs are encoded in the names of the metrics, and durations are emitted as timers
+	Flavor string `yaml:"flavor"`
+
+	// Prefix is prepended to the name of every metric
+	Prefix string `yaml:"prefix"`
+
+	// Tags are static tags added to every metric (i.e. 'env')
+	Tags map[string]string `yaml:"tags"`
+
+	// FlushInterval is the maximum time metrics are buffered before being sent
+	FlushInterval time.Duration `yaml:"flushInterval"`
+
+	// MaxPacketSize is the maximum size in bytes of each UDP packet, so they are not fragmented
+	MaxPacketSize int `yaml:"maxPacketSize"`
+}
+
+// EventLogOutputConfig represents the log of run completions, written as one JSON line per completed run
+// (i.e. to be loaded into a data warehouse)
+type EventLogOutputConfig struct {
+	// Sink is where completions are written: 'none', 'stdout', 'file' or 'http'
+	Sink string `yaml:"sink"`
+
+	File EventLogFileConfig `yaml:"file"`
+	HTTP EventLogHTTPConfig `yaml:"http"`
+}
+
+// EventLogFileConfig represents a file where completions are appended. It is rotated when it reaches its maximum size
+type EventLogFileConfig struct {
+	Path string `yaml:"path"`
+
+	// MaxSizeMB is the size in megabytes a file reaches before being rotated
+	MaxSizeMB int `yaml:"maxSizeMB"`
+
+	// MaxBackups is the amount of rotated files kept, as '<path>.1' (newest) to '<path>.<maxBackups>' (oldest)
+	MaxBackups int `yaml:"maxBackups"`
+}
+
+// EventLogHTTPConfig represents an HTTP endpoint where completions are posted in batches, as newline-delimited JSON
+type EventLogHTTPConfig struct {
+	URL string `yaml:"url"`
+
+	// Headers sent on each request (i.e. 'Authorization')
+	Headers map[string]string `yaml:"headers"`
+
+	// MaxBatchSize is the maximum amount of completions posted on each request
+	MaxBatchSize int `yaml:"maxBatchSize"`
+}
+
+// CloudEventsOutputConfig represents the emission of CloudEvents over HTTP when runs start, succeed, fail or are cancelled
+// (i.e. to a Knative broker)
+type CloudEventsOutputConfig struct {
+	// Sink is the URL where events are sent. Empty means they are only sent for the namespaces in NamespaceSinks
+	Sink string `yaml:"sink"`
+
+	// NamespaceSinks are the URLs where events of the runs in each namespace are sent, instead of Sink
+	NamespaceSinks map[string]string `yaml:"namespaceSinks"`
+
+	// Mode is the content mode of the events: 'binary' (attributes as 'ce-*' headers) or 'structured' (JSON envelope)
+	Mode string `yaml:"mode"`
+
+	Queue CloudEventsQueueConfig `yaml:"queue"`
+}
+
+// CloudEventsQueueConfig represents the in-memory queue of events waiting to be delivered
+type CloudEventsQueueConfig struct {
+	// Capacity is the amount of events queued. When it is full, new events are discarded
+	Capacity int `yaml:"capacity"`
+
+	// Workers is the amount of concurrent deliveries
+	Workers int `yaml:"workers"`
+
+	// MaxAttempts is the amount of times an event is sent before giving up.
+	// MinBackoff and MaxBackoff bound the time waited between attempts
+	MaxAttempts int           `yaml:"maxAttempts"`
+	MinBackoff  time.Duration `yaml:"minBackoff"`
+	MaxBackoff  time.Duration `yaml:"maxBackoff"`
+}
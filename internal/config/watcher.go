@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	//
+	"tekton-exporter/internal/globals"
+)
+
+const (
+	// reloadDebounceDelay is the time waited after the last change before reloading,
+	// as editors and Kubernetes (ConfigMap symlinks swap) produce several events per change
+	reloadDebounceDelay = 500 * time.Millisecond
+)
+
+// WatchFile call onReload with a new configuration each time the content of the file at path changes.
+// The configuration is crafted by 'load', so the caller can apply overrides (i.e. flags) on top of the file.
+// Invalid configurations are logged and ignored, so the current one is kept
+// Hey!, this function is intended to be executed as a go routine
+func WatchFile(ctx context.Context, path string, load func() (*Config, error), onReload func(*Config)) (err error) {
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// The directory is watched instead of the file, as files mounted from ConfigMaps are replaced, not written
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	lastContent, _ := os.ReadFile(path)
+
+	debounceTimer := time.NewTimer(reloadDebounceDelay)
+	debounceTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			debounceTimer.Reset(reloadDebounceDelay)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			globals.ExecContext.Logger.Errorf("error watching config file: %v", err)
+
+		case <-debounceTimer.C:
+			// Changes in other files of the directory are ignored
+			content, err := os.ReadFile(path)
+			if err != nil || bytes.Equal(content, lastContent) {
+				continue
+			}
+			lastContent = content
+
+			config, err := load()
+			if err != nil {
+				globals.ExecContext.Logger.Errorf("config file changed but it is invalid, keeping the current one: %v", err)
+				continue
+			}
+
+			globals.ExecContext.Logger.Info("config file changed. Reloading configuration...")
+			onReload(config)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultUnhealthyTimeout is the time a watcher can be disconnected before the exporter is considered unhealthy
+	DefaultUnhealthyTimeout = 5 * time.Minute
+)
+
+// WatcherStatus represents the state of a watcher of Kubernetes resources
+type WatcherStatus struct {
+	name string
+
+	mutex                sync.RWMutex
+	connected            bool
+	disconnectedSince    time.Time
+	lastEventTime        time.Time
+	lastError            string
+	lastErrorTime        time.Time
+	initialSyncCompleted bool
+}
+
+// WatcherReport represents the state of a watcher at a given moment, as it is reported by the endpoints
+type WatcherReport struct {
+	Name                 string     `json:"name"`
+	Connected            bool       `json:"connected"`
+	DisconnectedSince    *time.Time `json:"disconnectedSince,omitempty"`
+	LastEventTime        *time.Time `json:"lastEventTime,omitempty"`
+	LastError            string     `json:"lastError,omitempty"`
+	LastErrorTime        *time.Time `json:"lastErrorTime,omitempty"`
+	InitialSyncCompleted bool       `json:"initialSyncCompleted"`
+}
+
+// Report represents the state of all the watchers, as it is reported by the endpoints
+type Report struct {
+	Status   string          `json:"status"`
+	Watchers []WatcherReport `json:"watchers"`
+}
+
+// Checker keeps the state of the watchers to report the health and readiness of the exporter
+type Checker struct {
+	// unhealthyTimeout is the time a watcher can be disconnected before the exporter is considered unhealthy
+	unhealthyTimeout time.Duration
+
+	mutex    sync.RWMutex
+	watchers map[string]*WatcherStatus
+}
+
+// NewChecker return a new Checker without watchers
+func NewChecker(unhealthyTimeout time.Duration) *Checker {
+	return &Checker{
+		unhealthyTimeout: unhealthyTimeout,
+		watchers:         make(map[string]*WatcherStatus),
+	}
+}
+
+// Register add a watcher to the Checker, and return its status to be updated by the watcher.
+// Registering the same name twice return the same status
+func (c *Checker) Register(name string) *WatcherStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if status, found := c.watchers[name]; found {
+		return status
+	}
+
+	// Watchers are born disconnected, so the timeout is a grace period to connect for the first time
+	status := &WatcherStatus{name: name, disconnectedSince: time.Now()}
+	c.watchers[name] = status
+
+	return status
+}
+
+// SetConnected mark the watcher as connected or disconnected to the Kubernetes API
+func (w *WatcherStatus) SetConnected(connected bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.connected && !connected {
+		w.disconnectedSince = time.Now()
+	}
+	w.connected = connected
+}
+
+// RecordEvent account that the watcher has received an event
+func (w *WatcherStatus) RecordEvent() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.lastEventTime = time.Now()
+}
+
+// RecordError account that the watcher has failed
+func (w *WatcherStatus) RecordError(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.lastError = err.Error()
+	w.lastErrorTime = time.Now()
+}
+
+// SetInitialSyncCompleted mark the initial reconciliation of the watcher as completed.
+// It is never unset, as metrics of the already synced resources are still valid after a disconnection
+func (w *WatcherStatus) SetInitialSyncCompleted() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.initialSyncCompleted = true
+}
+
+// report return the state of the watcher at this moment
+func (w *WatcherStatus) report() (report WatcherReport) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	report = WatcherReport{
+		Name:                 w.name,
+		Connected:            w.connected,
+		LastError:            w.lastError,
+		InitialSyncCompleted: w.initialSyncCompleted,
+	}
+
+	if !w.connected {
+		report.DisconnectedSince = getTimeOrNil(w.disconnectedSince)
+	}
+	report.LastEventTime = getTimeOrNil(w.lastEventTime)
+	report.LastErrorTime = getTimeOrNil(w.lastErrorTime)
+
+	return report
+}
+
+// getReport return the state of all the watchers, and whether all of them pass the check
+func (c *Checker) getReport(check func(report *WatcherReport) bool) (report Report, passed bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	passed = true
+	report.Watchers = make([]WatcherReport, 0, len(c.watchers))
+	for _, status := range c.watchers {
+		watcherReport := status.report()
+		if !check(&watcherReport) {
+			passed = false
+		}
+		report.Watchers = append(report.Watchers, watcherReport)
+	}
+
+	sort.Slice(report.Watchers, func(i, j int) bool {
+		return report.Watchers[i].Name < report.Watchers[j].Name
+	})
+
+	return report, passed
+}
+
+// isHealthy return true when the watcher has not been disconnected for longer than the unhealthy timeout
+func (r *WatcherReport) isHealthy(unhealthyTimeout time.Duration) bool {
+	return r.Connected || r.DisconnectedSince == nil || time.Since(*r.DisconnectedSince) < unhealthyTimeout
+}
+
+// HealthzHandler report whether the exporter is alive.
+// It fails when a watcher has been disconnected for longer than the unhealthy timeout,
+// as the exporter is not able to recover by itself (i.e. failing in a loop)
+func (c *Checker) HealthzHandler(response http.ResponseWriter, request *http.Request) {
+	report, passed := c.getReport(func(report *WatcherReport) bool {
+		return report.isHealthy(c.unhealthyTimeout)
+	})
+	writeReport(response, report, passed)
+}
+
+// ReadyzHandler report whether the exporter is ready to be scraped.
+// It fails until the initial reconciliation of all the watchers is completed, so partial metrics are not scraped
+func (c *Checker) ReadyzHandler(response http.ResponseWriter, request *http.Request) {
+	report, passed := c.getReport(func(report *WatcherReport) bool {
+		return report.InitialSyncCompleted
+	})
+	writeReport(response, report, passed)
+}
+
+// writeReport write the report as JSON, with a status code depending on whether checks passed
+func writeReport(response http.ResponseWriter, report Report, passed bool) {
+	statusCode := http.StatusOK
+	report.Status = "ok"
+	if !passed {
+		statusCode = http.StatusServiceUnavailable
+		report.Status = "failed"
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(statusCode)
+	_ = json.NewEncoder(response).Encode(report)
+}
+
+// getTimeOrNil return a pointer to the time, or nil when it is zero
+func getTimeOrNil(timestamp time.Time) *time.Time {
+	if timestamp.IsZero() {
+		return nil
+	}
+	return &timestamp
+}
@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	// Kubernetes clients
+	// Ref: https://pkg.go.dev/k8s.io/client-go/tools/clientcmd
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	//
+	"tekton-exporter/internal/config"
+)
+
+const (
+	// clusterContextKey is the key of the context value containing the name of the cluster being watched
+	clusterContextKey = "cluster"
+)
+
+// Cluster represents a Kubernetes cluster whose runs are watched
+type Cluster struct {
+	// Name of the cluster. It is empty when a single cluster is watched
+	Name string
+
+	Client dynamic.Interface
+}
+
+// NewClusters return the clusters defined in configuration, with a client for each one.
+// When no cluster is defined, the cluster where the exporter is running is returned, with an empty name
+func NewClusters(ctx context.Context, clustersConfig []config.ClusterConfig) (clusters []Cluster, err error) {
+
+	if len(clustersConfig) == 0 {
+		client, err := NewClient()
+		if err != nil {
+			return nil, err
+		}
+		return []Cluster{{Client: client}}, nil
+	}
+
+	for _, clusterConfig := range clustersConfig {
+		restConfig, err := getClusterRestConfig(ctx, clusterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("impossible to configure client for cluster '%s': %w", clusterConfig.Name, err)
+		}
+
+		client, err := dynamic.NewForConfig(restConfig)
+		if err != nil {
+			return nil, fmt.Errorf("impossible to create client for cluster '%s': %w", clusterConfig.Name, err)
+		}
+
+		clusters = append(clusters, Cluster{Name: clusterConfig.Name, Client: client})
+	}
+
+	return clusters, nil
+}
+
+// WithCluster return a copy of the context carrying the name of the cluster being watched
+func WithCluster(ctx context.Context, clusterName string) context.Context {
+	return context.WithValue(ctx, clusterContextKey, clusterName)
+}
+
+// getCluster return the name of the cluster being watched, carried by the context
+func getCluster(ctx *context.Context) string {
+	clusterName, _ := (*ctx).Value(clusterContextKey).(string)
+	return clusterName
+}
+
+// getClusterRestConfig return the configuration to connect to a cluster,
+// from a kubeconfig file or from a kubeconfig stored in a Secret
+func getClusterRestConfig(ctx context.Context, clusterConfig config.ClusterConfig) (restConfig *rest.Config, err error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: clusterConfig.Context}
+
+	if clusterConfig.Secret == nil {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = clusterConfig.Kubeconfig
+
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	}
+
+	// Secrets are read from the cluster where the exporter is running
+	localConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := clientset.NewForConfig(localConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := clusterConfig.Secret.Namespace
+	if namespace == "" {
+		namespace = getPodNamespace()
+	}
+
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, clusterConfig.Secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	kubeconfig, found := secret.Data[clusterConfig.Secret.Key]
+	if !found {
+		return nil, fmt.Errorf("key '%s' not found in secret %s/%s", clusterConfig.Secret.Key, namespace, clusterConfig.Secret.Name)
+	}
+
+	apiConfig, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientcmd.NewDefaultClientConfig(*apiConfig, overrides).ClientConfig()
+}
@@ -0,0 +1,31 @@
+package kubernetes
+
+import (
+	"context"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/tekton"
+)
+
+// IsDeploymentRun return true when a run is marked as a deployment.
+// Runs are marked by the selectors defined in 'metrics.dora' configuration. All the defined selectors must match.
+// When no selector is defined, no run is a deployment
+func IsDeploymentRun(ctx *context.Context, run *tekton.Run) bool {
+	doraConfig := config.Current().Metrics.Dora
+	return doraConfig.IsDeployment(run.Metadata.Labels, run.Metadata.Annotations)
+}
+
+// GetDeploymentServiceName return the name of the service deployed by a run.
+// It is read from the label defined by 'metrics.dora.serviceLabel' configuration,
+// falling back to the name of the pipeline when the label is not present
+func GetDeploymentServiceName(ctx *context.Context, run *tekton.Run) string {
+
+	serviceLabel := config.Current().Metrics.Dora.ServiceLabel
+
+	if serviceName := run.Metadata.Labels[serviceLabel]; serviceLabel != "" && serviceName != "" {
+		return serviceName
+	}
+
+	return getValueOrPlaceholder(run.GetPipelineName())
+}
@@ -0,0 +1,76 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/tekton"
+)
+
+const (
+	// Annotations set by Pipelines-as-Code on the PipelineRuns it creates
+	// Ref: https://pipelinesascode.com/docs/guide/running/
+	pacRepoURLAnnotation      = "pipelinesascode.tekton.dev/repo-url"
+	pacShaAnnotation          = "pipelinesascode.tekton.dev/sha"
+	pacSourceBranchAnnotation = "pipelinesascode.tekton.dev/source-branch"
+	pacBranchAnnotation       = "pipelinesascode.tekton.dev/branch"
+)
+
+// GetRunGitPromLabels return a map with 'repository', 'revision' and 'branch' of the code processed by a run.
+// Values are looked up (in order) in Pipelines-as-Code annotations, well-known params
+// (defined by 'metrics.gitInfo' configuration) and 'status.provenance' of the run.
+// Missing values are populated with '#'. When nothing is found, 'found' is false
+func GetRunGitPromLabels(ctx *context.Context, run *tekton.Run) (labelsMap map[string]string, found bool) {
+	labelsMap = map[string]string{
+		"repository": "#",
+		"revision":   "#",
+		"branch":     "#",
+	}
+
+	annotations := run.Metadata.Annotations
+	params := run.GetStringParams()
+
+	gitInfoConfig := config.Current().Metrics.GitInfo
+	repositoryParams := gitInfoConfig.RepositoryParams
+	revisionParams := gitInfoConfig.RevisionParams
+	branchParams := gitInfoConfig.BranchParams
+
+	// Provenance URIs from git resolver are expressed like 'git+https://github.com/org/repo.git'
+	provenanceRepository, provenanceRevision := "", ""
+	if run.Status.Provenance != nil && run.Status.Provenance.RefSource != nil {
+		provenanceRepository = strings.TrimPrefix(run.Status.Provenance.RefSource.URI, "git+")
+		provenanceRevision = run.Status.Provenance.RefSource.Digest["sha1"]
+	}
+
+	candidates := map[string][]string{
+		"repository": append(append([]string{annotations[pacRepoURLAnnotation]},
+			getMapValues(params, repositoryParams)...), provenanceRepository),
+		"revision": append(append([]string{annotations[pacShaAnnotation]},
+			getMapValues(params, revisionParams)...), provenanceRevision),
+		"branch": append([]string{annotations[pacSourceBranchAnnotation], annotations[pacBranchAnnotation]},
+			getMapValues(params, branchParams)...),
+	}
+
+	for labelName, labelCandidates := range candidates {
+		for _, candidate := range labelCandidates {
+			if candidate != "" {
+				labelsMap[labelName] = candidate
+				found = true
+				break
+			}
+		}
+	}
+
+	return labelsMap, found
+}
+
+// getMapValues return the values of the requested keys of a map, in the same order.
+// Missing keys are returned as empty strings
+func getMapValues(source map[string]string, keys []string) (values []string) {
+	for _, key := range keys {
+		values = append(values, source[key])
+	}
+	return values
+}
@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	//
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+// RunTransition represents a change in the state of a run that is notified to RunHandlers
+type RunTransition string
+
+const (
+	// RunTransitionStarted is notified when a run starts (i.e. Tekton reports its start time)
+	RunTransitionStarted RunTransition = "started"
+
+	// RunTransitionCompleted is notified when a run reaches a terminal state (succeeded, failed or cancelled)
+	RunTransitionCompleted RunTransition = "completed"
+)
+
+// RunEvent represents a transition of a run, notified to RunHandlers
+type RunEvent struct {
+	Transition RunTransition
+
+	// Run is the object as received from Kubernetes, and StoreRun is its normalised version
+	Run      *tekton.Run
+	StoreRun store.Run
+}
+
+// RunHandler is notified about the transitions of the runs in the watch scope (i.e. to emit them to other systems).
+// Each transition is notified once, and only for runs transitioned while the exporter is running
+// Hey!, handlers are called from the watchers, so they must not block (i.e. enqueue the work for later)
+type RunHandler interface {
+	HandleRunEvent(ctx *context.Context, event RunEvent)
+}
+
+var (
+	runHandlersMutex sync.RWMutex
+	runHandlers      []RunHandler
+
+	// runHandlersEnabled allows disabling notifications (i.e. on leader election followers),
+	// so transitions are not notified several times by different replicas
+	runHandlersEnabled atomic.Bool
+
+	// startTime is used to discard transitions that happened before the exporter started, which are listed
+	// on the initial reconciliation. They were already notified by a previous instance
+	startTime = time.Now()
+
+	// notifiedTransitions remembers the transitions already notified, so they are not notified again
+	// when the runs are listed or modified later (i.e. on relists after their TTL has expired in the store)
+	notifiedTransitions = store.NewKeySet(maxNotifiedTransitions)
+)
+
+// maxNotifiedTransitions is the amount of transitions remembered. Runs emit two transitions each,
+// so this is enough to remember every run purged from the store during several days in busy clusters
+const maxNotifiedTransitions = 200000
+
+func init() {
+	runHandlersEnabled.Store(true)
+}
+
+// RegisterRunHandler add a handler that is notified about the transitions of the runs
+func RegisterRunHandler(handler RunHandler) {
+	runHandlersMutex.Lock()
+	defer runHandlersMutex.Unlock()
+
+	runHandlers = append(runHandlers, handler)
+}
+
+// SetRunHandlersEnabled enable or disable the notification of transitions to the handlers
+func SetRunHandlersEnabled(enabled bool) {
+	runHandlersEnabled.Store(enabled)
+}
+
+// notifyRunTransitions notify the handlers about the transitions of a run that were not notified yet.
+// Transitions are tracked apart from the store, as its completed runs are forgotten when their TTL expires
+func notifyRunTransitions(ctx *context.Context, run *tekton.Run, storeRun store.Run) {
+
+	// Runs seen for the first time once completed are notified as started too, so every completion has a start
+	if !storeRun.StartTime.IsZero() {
+		notifyRunTransition(ctx, RunEvent{Transition: RunTransitionStarted, Run: run, StoreRun: storeRun},
+			storeRun.StartTime)
+	}
+
+	if storeRun.IsCompleted() {
+		notifyRunTransition(ctx, RunEvent{Transition: RunTransitionCompleted, Run: run, StoreRun: storeRun},
+			storeRun.CompletionTime)
+	}
+}
+
+// notifyRunTransition notify an event to the handlers, unless it was notified before or it happened before
+// the exporter started. Transitions are remembered even when handlers are disabled, so replicas becoming leaders
+// do not notify again the ones happened while they were followers
+func notifyRunTransition(ctx *context.Context, event RunEvent, transitionTime time.Time) {
+	if !notifiedTransitions.Add(event.StoreRun.Key() + "/" + string(event.Transition)) {
+		return
+	}
+
+	if !runHandlersEnabled.Load() || !transitionTime.After(startTime) {
+		return
+	}
+
+	notifyRunEvent(ctx, event)
+}
+
+// notifyRunEvent call all the registered handlers with an event
+func notifyRunEvent(ctx *context.Context, event RunEvent) {
+	runHandlersMutex.RLock()
+	defer runHandlersMutex.RUnlock()
+
+	for _, handler := range runHandlers {
+		handler.HandleRunEvent(ctx, event)
+	}
+}
@@ -0,0 +1,104 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/watch"
+
+	//
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/store"
+)
+
+// recordingHandler keeps the events it is notified about
+type recordingHandler struct {
+	events []RunEvent
+}
+
+func (h *recordingHandler) HandleRunEvent(ctx *context.Context, event RunEvent) {
+	h.events = append(h.events, event)
+}
+
+// newPipelineRunObject return a completed PipelineRun as received from Kubernetes
+func newPipelineRunObject(uid string, startTime, completionTime time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "tekton.dev/v1",
+		"kind":       "PipelineRun",
+		"metadata": map[string]interface{}{
+			"name":              "build-" + uid,
+			"namespace":         "ci",
+			"uid":               uid,
+			"creationTimestamp": startTime.Format(time.RFC3339),
+		},
+		"spec": map[string]interface{}{
+			"pipelineRef": map[string]interface{}{"name": "build"},
+		},
+		"status": map[string]interface{}{
+			"startTime":      startTime.Format(time.RFC3339),
+			"completionTime": completionTime.Format(time.RFC3339),
+			"conditions": []interface{}{
+				map[string]interface{}{
+					"type":   "Succeeded",
+					"status": "True",
+					"reason": "Succeeded",
+				},
+			},
+		},
+	}
+}
+
+func TestRunTransitionsAreNotNotifiedAgainOnRelistAfterPurge(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	handler := &recordingHandler{}
+	RegisterRunHandler(handler)
+	defer func() {
+		runHandlersMutex.Lock()
+		runHandlers = nil
+		runHandlersMutex.Unlock()
+	}()
+
+	const completedRunsTTL = time.Second
+	runStore := store.NewStore(completedRunsTTL)
+	collector := metrics.NewCollector(runStore, metrics.CollectorOptions{
+		CompletedRunsTTL:    completedRunsTTL,
+		FlakinessWindowSize: 10,
+		RunKinds:            GetRunKindsMetrics(),
+	})
+
+	ctx := context.Background()
+	runKind, _ := GetRunKind("PipelineRun")
+
+	// Times are expressed in seconds on objects, so they are rounded up to be after the start of the exporter
+	runStartTime := startTime.Truncate(time.Second).Add(time.Second)
+	object := newPipelineRunObject("c0ffee", runStartTime, runStartTime.Add(time.Second))
+
+	HandleRunObject(&ctx, runKind, globals.CopyMap(object), watch.Added, collector)
+	if len(handler.events) != 2 {
+		t.Fatalf("expected started and completed transitions to be notified, got %d events", len(handler.events))
+	}
+	if handler.events[0].Transition != RunTransitionStarted || handler.events[1].Transition != RunTransitionCompleted {
+		t.Fatalf("unexpected transitions notified: %s, %s", handler.events[0].Transition, handler.events[1].Transition)
+	}
+
+	// Wait for the TTL to expire, so the run is purged from the store
+	time.Sleep(time.Until(runStartTime.Add(time.Second + completedRunsTTL + 100*time.Millisecond)))
+	if runs := runStore.List(); len(runs) != 0 {
+		t.Fatalf("expected the run to be purged from the store, got %d runs", len(runs))
+	}
+
+	// The run is still in the cluster, so the next relist and later modifications include it
+	HandleRunObject(&ctx, runKind, globals.CopyMap(object), watch.Added, collector)
+	HandleRunObject(&ctx, runKind, globals.CopyMap(object), watch.Modified, collector)
+
+	if len(handler.events) != 2 {
+		t.Fatalf("expected transitions not to be notified again after a relist, got %d events", len(handler.events))
+	}
+	if runs := runStore.List(); len(runs) != 0 {
+		t.Fatalf("expected the purged run not to be stored again, got %d runs", len(runs))
+	}
+}
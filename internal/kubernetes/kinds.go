@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	//
+	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+// RunKind represents a kind of Tekton run that is watched and exported.
+// Adding a new kind (i.e. CustomRun) is a matter of implementing this interface and registering it in RunKinds
+type RunKind interface {
+	// Kind return the name of the kind, as it is expressed in the objects (i.e. PipelineRun)
+	Kind() string
+
+	// GVR return the resource to be watched for this kind
+	GVR() schema.GroupVersionResource
+
+	// Metrics return the set of metrics exposed for this kind
+	Metrics() metrics.RunKindMetrics
+
+	// ExtractData fill the normalised run with the data that is specific to this kind (i.e. extra labels)
+	ExtractData(ctx *context.Context, run *tekton.Run, storeRun *store.Run)
+}
+
+var (
+	// RunKinds is the table of kinds watched by the exporter
+	RunKinds = []RunKind{
+		&pipelineRunKind{},
+		&taskRunKind{},
+	}
+)
+
+// GetRunKindsMetrics return the set of metrics exposed for all the registered kinds
+func GetRunKindsMetrics() (kindsMetrics []metrics.RunKindMetrics) {
+	for _, runKind := range RunKinds {
+		kindsMetrics = append(kindsMetrics, runKind.Metrics())
+	}
+	return kindsMetrics
+}
+
+// GetRunKind return the registered kind with a name (i.e. TaskRun), if any
+func GetRunKind(kind string) (runKind RunKind, found bool) {
+	for _, runKind := range RunKinds {
+		if runKind.Kind() == kind {
+			return runKind, true
+		}
+	}
+	return nil, false
+}
+
+// pipelineRunKind represents Tekton PipelineRun resources
+type pipelineRunKind struct{}
+
+func (k *pipelineRunKind) Kind() string {
+	return tekton.PipelineRunKind
+}
+
+func (k *pipelineRunKind) GVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    "tekton.dev",
+		Version:  "v1",
+		Resource: "pipelineruns",
+	}
+}
+
+func (k *pipelineRunKind) Metrics() metrics.RunKindMetrics {
+	return metrics.RunKindMetrics{
+		Kind:    tekton.PipelineRunKind,
+		GitInfo: true,
+	}
+}
+
+func (k *pipelineRunKind) ExtractData(ctx *context.Context, run *tekton.Run, storeRun *store.Run) {
+	if gitLabels, gitLabelsFound := GetRunGitPromLabels(ctx, run); gitLabelsFound {
+		storeRun.GitLabels = gitLabels
+	}
+
+	if IsDeploymentRun(ctx, run) {
+		storeRun.DeploymentService = GetDeploymentServiceName(ctx, run)
+	}
+}
+
+// taskRunKind represents Tekton TaskRun resources
+type taskRunKind struct{}
+
+func (k *taskRunKind) Kind() string {
+	return tekton.TaskRunKind
+}
+
+func (k *taskRunKind) GVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    "tekton.dev",
+		Version:  "v1",
+		Resource: "taskruns",
+	}
+}
+
+func (k *taskRunKind) Metrics() metrics.RunKindMetrics {
+	return metrics.RunKindMetrics{
+		Kind:    tekton.TaskRunKind,
+		Retries: true,
+	}
+}
+
+func (k *taskRunKind) ExtractData(ctx *context.Context, run *tekton.Run, storeRun *store.Run) {
+	storeRun.Task = getValueOrPlaceholder(run.GetTaskName())
+	storeRun.Retries = run.GetRetries()
+}
@@ -2,13 +2,8 @@ package kubernetes
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
-	"maps"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	// Kubernetes clients
@@ -18,35 +13,41 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	// Kubernetes types
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/watch"
 
 	//
+	"tekton-exporter/internal/config"
 	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/health"
 	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
 )
 
 const (
-	watchPipelinerunMessage = "Watching PipelineRun objects"
-	watchTaskrunMessage     = "Watching TaskRun objects"
+	watchRunsMessage  = "Watching %s objects"
+	syncRunsMessage   = "Listing %s objects to reconcile them"
+	resyncRunsMessage = "Watch scope changed. Listing %s objects again"
 
-	//
-	timestampsPromLabelsRetrievalError = "placeholder: %s"
+	// syncEventType is the type accounted for the resources processed on the initial reconciliation
+	syncEventType = "SYNC"
+
+	// Reasons why an event is not processed
+	processingErrorReasonDecode  = "decode"
+	processingErrorReasonProcess = "process"
+
+	// listPageSize is the amount of resources requested on each page when listing them
+	listPageSize = 500
 )
 
 var (
-	pipelineRunV1GVR = schema.GroupVersionResource{
-		Group:    "tekton.dev",
-		Version:  "v1",
-		Resource: "pipelineruns",
-	}
-
-	taskRunV1GVR = schema.GroupVersionResource{
-		Group:    "tekton.dev",
-		Version:  "v1",
-		Resource: "taskruns",
-	}
+	// resyncChannel is closed when the watchers must list the runs again (i.e. the watch scope changed),
+	// as runs entering the scope are not notified by the watches. It is replaced on each request
+	resyncMutex   sync.Mutex
+	resyncChannel = make(chan struct{})
 )
 
 // NewClient return a new Kubernetes Dynamic client from client-go SDK
@@ -65,379 +66,288 @@ func NewClient() (client *dynamic.DynamicClient, err error) {
 	return client, err
 }
 
-// GetRunPopulatedPromLabels return only user's desired labels from an object
-// Desired labels are defined by flag "--populated-labels"
-func GetRunPopulatedPromLabels(ctx *context.Context, object *map[string]interface{}) (labelsMap map[string]string, err error) {
-	labelsMap = make(map[string]string)
-
-	// Read labels from event's resource
-	objectLabels, err := GetObjectLabels(object)
-	if err != nil {
-		return labelsMap, err
-	}
-
-	// No existing labels on object, quit
-	if len(objectLabels) == 0 {
-		return labelsMap, nil
-	}
-
-	// Retrieve the 'populated-labels' flag from the context
-	populatedLabels := map[string]string{}
-	populatedLabelsFlag, ok := (*ctx).Value("flag-populated-labels").([]string)
-	if !ok {
-		return labelsMap, errors.New("populated labels flag not found in context")
-	}
-
-	//
-	parsedLabelsMap, _ := metrics.GetProcessedLabels(populatedLabelsFlag)
-	if err != nil {
-		return labelsMap, fmt.Errorf("error processing populated labels: %v", err)
-	}
-
-	// Iterate over populated label names
-	for _, populatedLabelName := range populatedLabelsFlag {
-
-		// Populated labels are dynamic, but labels must be pre-registered in the Prometheus SDK.
-		// This is a mechanism to avoid crashes if the labels are not present in the object.
-		populatedLabels[parsedLabelsMap[populatedLabelName]] = "#"
-
-		// Fill only the labels requested by the user.
-		// Label names will be changed to a Prometheus-compatible syntax.
-		if _, objectLabelsFound := objectLabels[populatedLabelName]; objectLabelsFound {
-			populatedLabels[parsedLabelsMap[populatedLabelName]] = objectLabels[populatedLabelName]
-		}
-	}
-
-	return populatedLabels, nil
-}
-
-// GetRunStatusPromLabels obtains the status-related labels for a pipeline based on the 'Succeeded' condition type and
+// GetRunStatusPromLabels obtains the status-related labels for a run based on the 'Succeeded' condition type and
 // returns a map containing the 'status' and 'reason' labels.
 // If the 'Succeeded' condition is not found, it populates a default condition with status 'False' and reason 'Unknown'.
-func GetRunStatusPromLabels(object *map[string]interface{}) (labelsMap map[string]string, err error) {
-	labelsMap = make(map[string]string)
-
-	// Default condition if 'Succeeded' condition is not found
-	defaultCondition := map[string]string{
-		"status": "False",
-		"reason": "Unknown",
-	}
+func GetRunStatusPromLabels(run *tekton.Run) (labelsMap map[string]string) {
 
 	// Obtain the status of 'Succeeded' condition type
-	condition, err := GetObjectCondition(object, "Succeeded")
-	if err != nil {
+	condition, found := run.GetCondition(tekton.SucceededConditionType)
+	if !found {
 		// Use the default condition
-		labelsMap["status"] = defaultCondition["status"]
-		labelsMap["reason"] = defaultCondition["reason"]
-		return labelsMap, nil
+		return map[string]string{
+			"status": "False",
+			"reason": "Unknown",
+		}
 	}
 
 	// Make the 'status' label understandable in metrics that are using it
 	runStatusLabelStatus := "failed"
-	if status, ok := condition["status"].(string); ok {
-		if strings.ToLower(status) == "true" {
-			runStatusLabelStatus = "success"
-		}
+	if run.IsSucceeded() {
+		runStatusLabelStatus = "success"
 	}
 
-	statusLabels := map[string]string{
+	return map[string]string{
 		"status": runStatusLabelStatus,
-		"reason": condition["reason"].(string),
+		"reason": condition.Reason,
 	}
-
-	return statusLabels, nil
 }
 
-// GetRunDurationPromLabels return a map with 'start_timestamp' and 'completion_timestamp'
-// from the object representing a run's status.
-// If any timestamp is missing, it populates a default value set to '#'
-func GetRunDurationPromLabels(object *map[string]interface{}) (labelsMap map[string]string, err error) {
-	labelsMap = make(map[string]string)
+// GetStoreRun return a normalised run from a PipelineRun or TaskRun,
+// containing all the data needed to render its metrics
+func GetStoreRun(ctx *context.Context, runKind RunKind, run *tekton.Run) (storeRun store.Run, err error) {
 
-	// Obtain the status of 'Succeeded' condition type
-	status, err := GetObjectStatus(object)
-	if err != nil {
-		return nil, err
-	}
+	// 1. Identity of the run
+	storeRun.Cluster = getCluster(ctx)
+	storeRun.Kind = run.Kind
+	storeRun.Name = run.Metadata.Name
+	storeRun.Namespace = run.Metadata.Namespace
+	storeRun.UID = string(run.Metadata.UID)
+	storeRun.Pipeline = getValueOrPlaceholder(run.GetPipelineName())
 
-	// If status is nil, return an error indicating missing status
-	if status == nil {
-		return nil, errors.New("status is missing in the object")
-	}
+	// 2. Object labels. Populated ones are selected at scrape time, so they can be changed on the fly
+	storeRun.Labels = run.Metadata.Labels
 
-	// Parse timestamps and populate labels
-	timestampLabels := make(map[string]string)
-	parseTimestamp := func(timestamp interface{}) (string, error) {
-		if timestamp == nil {
-			return "#", nil // Default value if timestamp is missing
-		}
-		parsedTime, err := time.Parse(time.RFC3339, timestamp.(string))
-		if err != nil {
-			return "", err // Return parsing error
-		}
-		return strconv.Itoa(int(parsedTime.Unix())), nil
-	}
+	// 3. Status-related data
+	statusLabels := GetRunStatusPromLabels(run)
+	storeRun.Status = statusLabels["status"]
+	storeRun.Reason = statusLabels["reason"]
 
-	// Parse start timestamp
-	startTimestamp, err := parseTimestamp(status["startTime"])
-	if err != nil {
-		return nil, err
+	// 4. Duration-related data
+	if run.Status.StartTime != nil {
+		storeRun.StartTime = run.Status.StartTime.Time
 	}
-	timestampLabels["start_timestamp"] = startTimestamp
-
-	// Parse completion timestamp
-	completionTimestamp, err := parseTimestamp(status["completionTime"])
-	if err != nil {
-		return nil, err
+	if run.Status.CompletionTime != nil {
+		storeRun.CompletionTime = run.Status.CompletionTime.Time
 	}
-	timestampLabels["completion_timestamp"] = completionTimestamp
-
-	return timestampLabels, nil
-}
 
-// WatchPipelineRuns TODO
-// Hey!, this function is intended to be executed as a go routine
-func WatchPipelineRuns(ctx *context.Context, client *dynamic.DynamicClient) (err error) {
-	globals.ExecContext.Logger.Info(watchPipelinerunMessage)
+	// 5. Kind-specific data
+	runKind.ExtractData(ctx, run, &storeRun)
 
-	// Create a watcher for PipelineRun resources
-	pipelineRunWatcher, err := client.Resource(pipelineRunV1GVR).Watch(*ctx, metav1.ListOptions{})
-	if err != nil {
-		return err
-	}
-	defer pipelineRunWatcher.Stop()
-
-	for pipelineRunEvent := range pipelineRunWatcher.ResultChan() {
-		// Extract the unstructured object from the event
-		unstructuredObject, err := GetUnstructuredFromRuntimeObject(&pipelineRunEvent.Object)
-		if err != nil {
-			globals.ExecContext.Logger.Errorf("failed to parse object: %v", err)
-			continue
-		}
+	return storeRun, nil
+}
 
-		// Process the PipelineRun event
-		err = ProcessPipelineRunEvent(ctx, &unstructuredObject, pipelineRunEvent.Type)
-		if err != nil {
-			globals.ExecContext.Logger.Errorf("failed to process PipelineRun event: %v", err)
-			continue
-		}
+// getValueOrPlaceholder return the value, or '#' when it is empty
+func getValueOrPlaceholder(value string) string {
+	if value == "" {
+		return "#"
 	}
-
-	return nil
+	return value
 }
 
-// TODO
-func ProcessPipelineRunEvent(ctx *context.Context, object *map[string]interface{}, eventType watch.EventType) error {
+// RequestResync make the running watchers list the runs again, so runs that entered the watch scope are processed
+func RequestResync() {
+	resyncMutex.Lock()
+	defer resyncMutex.Unlock()
 
-	// 1. Craft common labels
-	objectBasicData, err := GetObjectBasicData(object)
-	if err != nil {
-		return err
-	}
+	close(resyncChannel)
+	resyncChannel = make(chan struct{})
+}
 
-	commonLabels := map[string]string{
-		"name":      objectBasicData["name"].(string),
-		"namespace": objectBasicData["namespace"].(string),
-	}
+// getResyncChannel return the channel closed on the next request to list the runs again
+func getResyncChannel() <-chan struct{} {
+	resyncMutex.Lock()
+	defer resyncMutex.Unlock()
 
-	// 2. Craft populated labels from PipelineRun object labels and merge them
-	populatedLabels, err := GetRunPopulatedPromLabels(ctx, object)
-	if err != nil {
-		return err
-	}
+	return resyncChannel
+}
 
-	maps.Copy(commonLabels, populatedLabels)
+// WatchRuns list the resources of a kind of run to reconcile them, and then watch them to process their events.
+// Runs that are not listed anymore (i.e. deleted while the watcher was disconnected) are deleted.
+// The resource version of the last event is kept in resourceVersion, so routine restarts (i.e. watches closed
+// by the API server) resume from it without listing the runs again. It is cleared on errors (i.e. '410 Gone'),
+// so runs are listed on the restart after backing off, and when a resync is requested, which makes it return
+// Hey!, this function is intended to be executed as a go routine
+func WatchRuns(ctx *context.Context, client dynamic.Interface, runKind RunKind, collector *metrics.Collector,
+	watcherStatus *health.WatcherStatus, resourceVersion *string) (err error) {
 
-	// Conversion to a Prometheus SDK Labels type will be needed later
-	// Maps in golang are ReferenceTypes, so we need to iterate to copy
-	commonLabelsProm := prometheus.Labels{}
-	for k, v := range commonLabels {
-		commonLabelsProm[k] = v
-	}
+	defer func() {
+		watcherStatus.SetConnected(false)
+		if err != nil {
+			*resourceVersion = ""
+			watcherStatus.RecordError(err)
+		}
+	}()
 
-	// 3. Craft status-related labels
-	statusLabels, err := GetRunStatusPromLabels(object)
-	if err != nil {
-		return err
-	}
+	// Requests done while listing are noticed too
+	resync := getResyncChannel()
 
-	runStatusLabelStatusValue := 0
-	if statusLabels["status"] == "success" {
-		runStatusLabelStatusValue = 1
+	// Reconcile the existing resources of the kind, unless the watch can be resumed
+	if *resourceVersion == "" {
+		*resourceVersion, err = SyncRuns(ctx, client, runKind, collector)
+		if err != nil {
+			return err
+		}
 	}
+	watcherStatus.SetConnected(true)
+	watcherStatus.SetInitialSyncCompleted()
 
-	// Prepare labels for '_status' metric
-	maps.Copy(statusLabels, commonLabels)
-	statusLabelMap := prometheus.Labels(statusLabels)
+	globals.ExecContext.Logger.Infof(watchRunsMessage, runKind.Kind())
 
-	// 3. Craft duration-related labels
-	durationLabels, err := GetRunDurationPromLabels(object)
+	// Create a watcher for the resources of the kind, starting after the listed state or the last event.
+	// Bookmarks keep the resource version up to date when there are no events for a while
+	runWatcher, err := client.Resource(runKind.GVR()).Watch(*ctx, metav1.ListOptions{
+		ResourceVersion:     *resourceVersion,
+		AllowWatchBookmarks: true,
+	})
 	if err != nil {
 		return err
 	}
+	defer runWatcher.Stop()
 
-	// Calculate duration for the Run object
-	runDurationValue := 0
-	if durationLabels["start_timestamp"] != "#" && durationLabels["completion_timestamp"] != "#" {
-		runStartTime, _ := strconv.Atoi(durationLabels["start_timestamp"])
-		runCompletionTime, _ := strconv.Atoi(durationLabels["completion_timestamp"])
-		runDurationValue = runCompletionTime - runStartTime
-	}
+	for {
+		var runEvent watch.Event
+		var open bool
 
-	// Prepare labels for '_duration' metric
-	maps.Copy(durationLabels, commonLabels)
-	durationLabelMap := prometheus.Labels(durationLabels)
+		select {
+		case <-resync:
+			globals.ExecContext.Logger.Infof(resyncRunsMessage, runKind.Kind())
+			*resourceVersion = ""
+			return nil
+		case runEvent, open = <-runWatcher.ResultChan():
+		}
 
-	///////////////////////////////////////////////////////
+		// Watch channels are closed by the API server from time to time. This is not an error
+		if !open {
+			return nil
+		}
 
-	switch eventType {
-	case watch.Added:
-		globals.ExecContext.Logger.With(zap.Any("labels", statusLabelMap)).
-			Info("PipelineRun resource created. Exposing metrics...")
-		metrics.Pool.PipelineRunStatus.With(statusLabelMap).Set(float64(runStatusLabelStatusValue))
-		metrics.Pool.PipelineRunDuration.With(durationLabelMap).Set(float64(runDurationValue))
+		watcherStatus.RecordEvent()
+		metrics.WatchEvents.WithLabelValues(runKind.Kind(), string(runEvent.Type)).Inc()
+		metrics.LastEventTimestamp.WithLabelValues(runKind.Kind()).SetToCurrentTime()
 
-	case watch.Modified:
-		globals.ExecContext.Logger.With(zap.Any("labels", statusLabelMap)).
-			Info("PipelineRun resource modified. Updating metrics...")
+		// Errors are sent as events (i.e. expired resource version), so the watcher must be restarted
+		if runEvent.Type == watch.Error {
+			return apierrors.FromObject(runEvent.Object)
+		}
 
-		// Delete metrics that partially match labels
-		_ = metrics.Pool.PipelineRunStatus.DeletePartialMatch(commonLabelsProm)
-		_ = metrics.Pool.PipelineRunDuration.DeletePartialMatch(commonLabelsProm)
+		// Extract the unstructured object from the event
+		unstructuredObject, err := GetUnstructuredFromRuntimeObject(&runEvent.Object)
+		if err != nil {
+			metrics.EventProcessingErrors.WithLabelValues(runKind.Kind(), processingErrorReasonDecode).Inc()
+			globals.ExecContext.Logger.Errorf("failed to parse object: %v", err)
+			continue
+		}
 
-		// Regenerate the metric with newer labels
-		metrics.Pool.PipelineRunStatus.With(statusLabelMap).Set(float64(runStatusLabelStatusValue))
-		metrics.Pool.PipelineRunDuration.With(durationLabelMap).Set(float64(runDurationValue))
+		// Bookmarks only carry the resource version
+		if runEvent.Type != watch.Bookmark {
+			HandleRunObject(ctx, runKind, unstructuredObject, runEvent.Type, collector)
+		}
 
-	case watch.Deleted:
-		globals.ExecContext.Logger.With(zap.Any("labels", commonLabelsProm)).
-			Info("PipelineRun resource deleted. Cleaning up metrics...")
-		_ = metrics.Pool.PipelineRunStatus.DeletePartialMatch(commonLabelsProm)
-		_ = metrics.Pool.PipelineRunDuration.DeletePartialMatch(commonLabelsProm)
+		objectMeta := unstructured.Unstructured{Object: unstructuredObject}
+		if objectMeta.GetResourceVersion() != "" {
+			*resourceVersion = objectMeta.GetResourceVersion()
+		}
 	}
-
-	return nil
 }
 
-// WatchTaskRuns TODO
-// Hey!, this function is intended to be executed as a go routine
-func WatchTaskRuns(ctx *context.Context, client *dynamic.DynamicClient) (err error) {
-	globals.ExecContext.Logger.Info(watchTaskrunMessage)
+// SyncRuns list all the resources of a kind of run and process them as created ones.
+// Stored runs of the kind that are not listed are deleted. It returns the resource version of the list,
+// so the resources can be watched from it
+func SyncRuns(ctx *context.Context, client dynamic.Interface, runKind RunKind,
+	collector *metrics.Collector) (resourceVersion string, err error) {
 
-	// Create a watcher for TaskRun resources
-	taskRunWatcher, err := client.Resource(taskRunV1GVR).Watch(*ctx, metav1.ListOptions{})
-	if err != nil {
-		return err
-	}
-	defer taskRunWatcher.Stop()
+	globals.ExecContext.Logger.Infof(syncRunsMessage, runKind.Kind())
 
-	for taskRunEvent := range taskRunWatcher.ResultChan() {
-		// Extract the unstructured object from the event
-		unstructuredObject, err := GetUnstructuredFromRuntimeObject(&taskRunEvent.Object)
-		if err != nil {
-			globals.ExecContext.Logger.Errorf("failed to parse object: %v", err)
-			continue
-		}
+	listedRuns := make(map[string]bool)
+	listOptions := metav1.ListOptions{Limit: listPageSize}
 
-		// Process the TaskRun event
-		err = ProcessTaskRunEvent(ctx, &unstructuredObject, taskRunEvent.Type)
+	// Resources are listed in pages, as there can be thousands of them
+	for {
+		runList, err := client.Resource(runKind.GVR()).List(*ctx, listOptions)
 		if err != nil {
-			globals.ExecContext.Logger.Errorf("failed to process TaskRun event: %v", err)
-			continue
+			return "", err
 		}
-	}
 
-	return nil
-}
+		for index := range runList.Items {
+			metrics.WatchEvents.WithLabelValues(runKind.Kind(), syncEventType).Inc()
 
-// TODO
-func ProcessTaskRunEvent(ctx *context.Context, object *map[string]interface{}, eventType watch.EventType) error {
+			listedRuns[string(runList.Items[index].GetUID())] = true
+			HandleRunObject(ctx, runKind, runList.Items[index].Object, watch.Added, collector)
+		}
 
-	// 1. Craft common labels
-	objectBasicData, err := GetObjectBasicData(object)
-	if err != nil {
-		return err
+		resourceVersion = runList.GetResourceVersion()
+		listOptions.Continue = runList.GetContinue()
+		if listOptions.Continue == "" {
+			break
+		}
 	}
 
-	commonLabels := map[string]string{
-		"name":      objectBasicData["name"].(string),
-		"namespace": objectBasicData["namespace"].(string),
-	}
+	cluster := getCluster(ctx)
+	collector.DeleteRunsFunc(func(run *store.Run) bool {
+		return run.Cluster == cluster && run.Kind == runKind.Kind() && !listedRuns[run.UID]
+	})
 
-	// 2. Craft populated labels from TaskRun object labels and merge them
-	populatedLabels, err := GetRunPopulatedPromLabels(ctx, object)
-	if err != nil {
-		return err
-	}
+	return resourceVersion, nil
+}
 
-	maps.Copy(commonLabels, populatedLabels)
+// HandleRunObject decode a run from an unstructured object and process the event received for it.
+// Errors are logged and accounted, as they only affect this object
+func HandleRunObject(ctx *context.Context, runKind RunKind, object map[string]interface{}, eventType watch.EventType,
+	collector *metrics.Collector) {
 
-	// Conversion to a Prometheus SDK Labels type will be needed later
-	// Maps in golang are ReferenceTypes, so we need to iterate to copy
-	commonLabelsProm := prometheus.Labels{}
-	for k, v := range commonLabels {
-		commonLabelsProm[k] = v
+	// Runs owned by other replicas are discarded as soon as possible, as they are never exported by this one.
+	// When the shards change, runs are listed again (see RequestResync), so the ones taken over are processed
+	objectMeta := unstructured.Unstructured{Object: object}
+	shardConfig := config.Current().Watch.Shard
+	if !shardConfig.Owns(objectMeta.GetNamespace(), string(objectMeta.GetUID())) {
+		return
 	}
 
-	// 3. Craft status-related labels
-	statusLabels, err := GetRunStatusPromLabels(object)
+	startTime := time.Now()
+	defer func() {
+		metrics.EventProcessingDuration.WithLabelValues(runKind.Kind()).Observe(time.Since(startTime).Seconds())
+	}()
+
+	// Decode the run once, so the rest of the process works with typed fields
+	run, err := tekton.NewRunFromUnstructured(runKind.Kind(), object)
 	if err != nil {
-		return err
+		metrics.EventProcessingErrors.WithLabelValues(runKind.Kind(), processingErrorReasonDecode).Inc()
+		globals.ExecContext.Logger.Errorf("failed to parse object: %v", err)
+		return
 	}
 
-	runStatusLabelStatusValue := 0
-	if statusLabels["status"] == "success" {
-		runStatusLabelStatusValue = 1
+	// Process the event
+	err = ProcessRunEvent(ctx, runKind, run, eventType, collector)
+	if err != nil {
+		metrics.EventProcessingErrors.WithLabelValues(runKind.Kind(), processingErrorReasonProcess).Inc()
+		globals.ExecContext.Logger.Errorf("failed to process %s event: %v", runKind.Kind(), err)
 	}
+}
 
-	// Prepare labels for '_status' metric
-	maps.Copy(statusLabels, commonLabels)
-	statusLabelMap := prometheus.Labels(statusLabels)
+// ProcessRunEvent update the metrics of a run according to the event received for it
+func ProcessRunEvent(ctx *context.Context, runKind RunKind, object *tekton.Run, eventType watch.EventType,
+	collector *metrics.Collector) error {
 
-	// 3. Craft duration-related labels
-	durationLabels, err := GetRunDurationPromLabels(object)
+	run, err := GetStoreRun(ctx, runKind, object)
 	if err != nil {
 		return err
 	}
 
-	// Calculate duration for the Run object
-	runDurationValue := 0
-	if durationLabels["start_timestamp"] != "#" && durationLabels["completion_timestamp"] != "#" {
-		runStartTime, _ := strconv.Atoi(durationLabels["start_timestamp"])
-		runCompletionTime, _ := strconv.Atoi(durationLabels["completion_timestamp"])
-		runDurationValue = runCompletionTime - runStartTime
+	// Runs outside the watch scope are not exported.
+	// They are deleted anyway, as they could have been exported before a change in the scope
+	if !config.Current().Watch.Matches(run.Namespace, run.UID, run.Labels) {
+		collector.DeleteRun(run)
+		return nil
 	}
 
-	// Prepare labels for '_duration' metric
-	maps.Copy(durationLabels, commonLabels)
-	durationLabelMap := prometheus.Labels(durationLabels)
-
-	///////////////////////////////////////////////////////
+	runLogger := globals.ExecContext.Logger.With(zap.String("name", run.Name), zap.String("namespace", run.Namespace),
+		zap.String("status", run.Status), zap.String("reason", run.Reason))
 
 	switch eventType {
 	case watch.Added:
-		globals.ExecContext.Logger.With(zap.Any("labels", statusLabelMap)).
-			Info("TaskRun resource created. Exposing metrics...")
-		metrics.Pool.TaskRunStatus.With(statusLabelMap).Set(float64(runStatusLabelStatusValue))
-		metrics.Pool.TaskRunDuration.With(durationLabelMap).Set(float64(runDurationValue))
+		runLogger.Infof("%s resource created. Exposing metrics...", run.Kind)
+		collector.UpdateRun(run)
+		notifyRunTransitions(ctx, object, run)
 
 	case watch.Modified:
-		globals.ExecContext.Logger.With(zap.Any("labels", statusLabelMap)).
-			Info("TaskRun resource modified. Updating metrics...")
-
-		// Delete metrics that partially match labels
-		_ = metrics.Pool.TaskRunStatus.DeletePartialMatch(commonLabelsProm)
-		_ = metrics.Pool.TaskRunDuration.DeletePartialMatch(commonLabelsProm)
-
-		// Regenerate the metric with newer labels
-		metrics.Pool.TaskRunStatus.With(statusLabelMap).Set(float64(runStatusLabelStatusValue))
-		metrics.Pool.TaskRunDuration.With(durationLabelMap).Set(float64(runDurationValue))
+		runLogger.Infof("%s resource modified. Updating metrics...", run.Kind)
+		collector.UpdateRun(run)
+		notifyRunTransitions(ctx, object, run)
 
 	case watch.Deleted:
-		globals.ExecContext.Logger.With(zap.Any("labels", commonLabelsProm)).
-			Info("TaskRun resource deleted. Cleaning up metrics...")
-		_ = metrics.Pool.TaskRunStatus.DeletePartialMatch(commonLabelsProm)
-		_ = metrics.Pool.TaskRunDuration.DeletePartialMatch(commonLabelsProm)
+		runLogger.Infof("%s resource deleted. Cleaning up metrics...", run.Kind)
+		collector.DeleteRun(run)
 	}
 
 	return nil
@@ -0,0 +1,264 @@
+package kubernetes
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/health"
+	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/store"
+)
+
+// newFakeClient return a fake dynamic client serving the given PipelineRuns
+func newFakeClient(objects ...map[string]interface{}) *dynamicfake.FakeDynamicClient {
+	runtimeObjects := make([]runtime.Object, 0, len(objects))
+	for _, object := range objects {
+		runtimeObjects = append(runtimeObjects, &unstructured.Unstructured{Object: object})
+	}
+
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{(&pipelineRunKind{}).GVR(): "PipelineRunList"}, runtimeObjects...)
+}
+
+// setWatchConfig put in use a configuration with the given watch scope
+func setWatchConfig(t *testing.T, modify func(watchConfig *config.WatchConfig)) {
+	currentConfig := config.NewDefault()
+	modify(&currentConfig.Watch)
+
+	if err := currentConfig.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.SetCurrent(currentConfig)
+}
+
+// waitForRuns wait until the store has the given amount of runs
+func waitForRuns(t *testing.T, runStore *store.Store, amount int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(runStore.List()) != amount {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d stored runs, got %d", amount, len(runStore.List()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForReturn wait until a watcher returns, failing when it takes too long
+func waitForReturn(t *testing.T, done chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the watcher to return")
+		return nil
+	}
+}
+
+func TestWatchRunsListsAgainOnResync(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+	defer config.SetCurrent(nil)
+
+	setWatchConfig(t, func(watchConfig *config.WatchConfig) { watchConfig.Namespaces = []string{"ci"} })
+
+	runStartTime := time.Now().Add(-time.Hour)
+	ciRun := newPipelineRunObject("f00d", runStartTime, runStartTime.Add(time.Minute))
+	cdRun := newPipelineRunObject("decaf", runStartTime, runStartTime.Add(time.Minute))
+	cdRun["metadata"].(map[string]interface{})["namespace"] = "cd"
+
+	runStore := store.NewStore(0)
+	collector := metrics.NewCollector(runStore, metrics.CollectorOptions{FlakinessWindowSize: 10, RunKinds: GetRunKindsMetrics()})
+	client := newFakeClient(ciRun, cdRun)
+	runKind, _ := GetRunKind("PipelineRun")
+	watcherStatus := health.NewChecker(health.DefaultUnhealthyTimeout).Register("PipelineRun")
+
+	ctx := context.Background()
+	var resourceVersion string
+	watch := func() chan error {
+		done := make(chan error, 1)
+		go func() { done <- WatchRuns(&ctx, client, runKind, collector, watcherStatus, &resourceVersion) }()
+		return done
+	}
+
+	done := watch()
+	waitForRuns(t, runStore, 1)
+
+	// Runs entering the widened scope are not notified by the watch, so they are only found by listing them again
+	setWatchConfig(t, func(watchConfig *config.WatchConfig) { watchConfig.Namespaces = []string{"ci", "cd"} })
+	RequestResync()
+
+	if err := waitForReturn(t, done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	done = watch()
+	waitForRuns(t, runStore, 2)
+
+	RequestResync()
+	_ = waitForReturn(t, done)
+}
+
+func TestWatchRunsListsAgainOnShardChange(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+	defer config.SetCurrent(nil)
+
+	// Runs are sharded by uid, so the shard owning each of them is known beforehand
+	uids := []string{"0a", "1b", "2c", "3d", "4e", "5f"}
+	shardConfig := config.ShardConfig{Count: 2, Index: 0, Key: config.ShardKeyUID}
+
+	var objects []map[string]interface{}
+	var ownedRuns int
+	runStartTime := time.Now().Add(-time.Hour)
+	for _, uid := range uids {
+		objects = append(objects, newPipelineRunObject("shard-"+uid, runStartTime, runStartTime.Add(time.Minute)))
+		if shardConfig.Owns("ci", "shard-"+uid) {
+			ownedRuns++
+		}
+	}
+	if ownedRuns == 0 || ownedRuns == len(uids) {
+		t.Fatalf("expected runs to be split across shards, got %d of %d in the first one", ownedRuns, len(uids))
+	}
+
+	setWatchConfig(t, func(watchConfig *config.WatchConfig) { watchConfig.Shard = shardConfig })
+
+	runStore := store.NewStore(0)
+	collector := metrics.NewCollector(runStore, metrics.CollectorOptions{FlakinessWindowSize: 10, RunKinds: GetRunKindsMetrics()})
+	client := newFakeClient(objects...)
+	runKind, _ := GetRunKind("PipelineRun")
+	watcherStatus := health.NewChecker(health.DefaultUnhealthyTimeout).Register("PipelineRun")
+
+	ctx := context.Background()
+	var resourceVersion string
+	watch := func() chan error {
+		done := make(chan error, 1)
+		go func() { done <- WatchRuns(&ctx, client, runKind, collector, watcherStatus, &resourceVersion) }()
+		return done
+	}
+
+	done := watch()
+	waitForRuns(t, runStore, ownedRuns)
+
+	// The replica of the other shard is gone, so this one takes over all the runs
+	setWatchConfig(t, func(watchConfig *config.WatchConfig) {
+		watchConfig.Shard = config.ShardConfig{Count: 1, Key: config.ShardKeyUID}
+	})
+	RequestResync()
+
+	if err := waitForReturn(t, done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	done = watch()
+	waitForRuns(t, runStore, len(uids))
+
+	RequestResync()
+	_ = waitForReturn(t, done)
+}
+
+// countActions return the amount of requests done by a fake client with a verb (i.e. 'list')
+func countActions(client *dynamicfake.FakeDynamicClient, verb string) (count int) {
+	for _, action := range client.Actions() {
+		if action.GetVerb() == verb {
+			count++
+		}
+	}
+	return count
+}
+
+func TestWatchRunsResumesFromLastResourceVersion(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	runStartTime := time.Now().Add(-time.Hour)
+	object := newPipelineRunObject("cafe", runStartTime, runStartTime.Add(time.Minute))
+	object["metadata"].(map[string]interface{})["resourceVersion"] = "42"
+
+	bookmark := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "tekton.dev/v1",
+		"kind":       "PipelineRun",
+		"metadata":   map[string]interface{}{"resourceVersion": "57"},
+	}}
+
+	runStore := store.NewStore(0)
+	collector := metrics.NewCollector(runStore, metrics.CollectorOptions{FlakinessWindowSize: 10, RunKinds: GetRunKindsMetrics()})
+	client := newFakeClient()
+	runKind, _ := GetRunKind("PipelineRun")
+	watcherStatus := health.NewChecker(health.DefaultUnhealthyTimeout).Register("PipelineRun")
+
+	// Each watch is served by a fake watcher controlled by the test, keeping the resource version requested
+	var mutex sync.Mutex
+	var runWatcher *watch.FakeWatcher
+	var watchedVersions []string
+	client.PrependWatchReactor("pipelineruns", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		watchedVersions = append(watchedVersions, action.(k8stesting.WatchActionImpl).GetWatchRestrictions().ResourceVersion)
+		return true, runWatcher, nil
+	})
+
+	ctx := context.Background()
+	var resourceVersion string
+	startWatch := func() chan error {
+		mutex.Lock()
+		runWatcher = watch.NewFake()
+		mutex.Unlock()
+
+		done := make(chan error, 1)
+		go func() { done <- WatchRuns(&ctx, client, runKind, collector, watcherStatus, &resourceVersion) }()
+		return done
+	}
+
+	// Runs are listed on the first start, and the watch is closed by the API server after some events
+	done := startWatch()
+	runWatcher.Add(&unstructured.Unstructured{Object: object})
+	runWatcher.Action(watch.Bookmark, bookmark)
+	runWatcher.Stop()
+
+	if err := waitForReturn(t, done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resourceVersion != "57" || len(runStore.List()) != 1 {
+		t.Fatalf("expected the run to be stored and the bookmark version kept, got %q and %d runs",
+			resourceVersion, len(runStore.List()))
+	}
+
+	// Routine restarts resume from the last version, without listing the runs again
+	done = startWatch()
+	runWatcher.Error(&apierrors.NewResourceExpired("too old resource version").ErrStatus)
+
+	err := waitForReturn(t, done)
+	if !apierrors.IsResourceExpired(err) {
+		t.Fatalf("expected an expired error, got %v", err)
+	}
+	if listings := countActions(client, "list"); listings != 1 || watchedVersions[1] != "57" {
+		t.Fatalf("expected the watch to be resumed from version 57 without listing, got %d listings and versions %v",
+			listings, watchedVersions)
+	}
+
+	// Expired versions are forgotten, so the runs are listed again on next restart
+	if resourceVersion != "" {
+		t.Fatalf("expected the resource version to be cleared on errors, got %q", resourceVersion)
+	}
+
+	done = startWatch()
+	runWatcher.Stop()
+
+	if err = waitForReturn(t, done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if listings := countActions(client, "list"); listings != 2 {
+		t.Errorf("expected runs to be listed again after the error, got %d listings", listings)
+	}
+}
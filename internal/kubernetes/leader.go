@@ -0,0 +1,117 @@
+package kubernetes
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	// Ref: https://pkg.go.dev/k8s.io/client-go/tools/leaderelection
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	//
+	"tekton-exporter/internal/globals"
+)
+
+const (
+	// serviceAccountNamespaceFile contains the namespace of the pod, when running inside Kubernetes
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+	// Timings of the leader election. They are the ones recommended by client-go
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+
+	startedLeadingMessage = "leadership acquired on lease %s/%s. Exporting metrics of the runs"
+	stoppedLeadingMessage = "leadership lost on lease %s/%s. Not exporting metrics of the runs"
+	newLeaderMessage      = "current leader on lease %s/%s is %s"
+)
+
+// LeaderElectionOptions represents the options to take part in a leader election
+type LeaderElectionOptions struct {
+	// LeaseName and LeaseNamespace identify the Lease used as lock.
+	// When LeaseNamespace is empty, the namespace of the pod is used
+	LeaseName      string
+	LeaseNamespace string
+
+	// OnLeadershipChange is called each time this replica acquires or loses the leadership
+	OnLeadershipChange func(isLeader bool)
+}
+
+// RunLeaderElection take part in a Lease-based leader election until the context is done.
+// When the leadership is lost, this replica keeps taking part in the election to be able to acquire it again.
+// The Lease is released on cancellation, so other replicas take over without waiting for it to expire
+// Hey!, this function is intended to be executed as a go routine
+func RunLeaderElection(ctx context.Context, options LeaderElectionOptions) (err error) {
+
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	if options.LeaseNamespace == "" {
+		options.LeaseNamespace = getPodNamespace()
+	}
+
+	// Pod names are unique, and they are the hostname of the pods
+	identity, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      options.LeaseName,
+			Namespace: options.LeaseNamespace,
+		},
+		Client: client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            options.LeaseName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					globals.ExecContext.Logger.Infof(startedLeadingMessage, options.LeaseNamespace, options.LeaseName)
+					options.OnLeadershipChange(true)
+				},
+				OnStoppedLeading: func() {
+					globals.ExecContext.Logger.Infof(stoppedLeadingMessage, options.LeaseNamespace, options.LeaseName)
+					options.OnLeadershipChange(false)
+				},
+				OnNewLeader: func(leaderIdentity string) {
+					globals.ExecContext.Logger.Infof(newLeaderMessage, options.LeaseNamespace, options.LeaseName, leaderIdentity)
+				},
+			},
+		})
+	}
+
+	return nil
+}
+
+// getPodNamespace return the namespace where the exporter is running, or 'default' when it is not known
+func getPodNamespace() string {
+	namespace, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil || strings.TrimSpace(string(namespace)) == "" {
+		return "default"
+	}
+	return strings.TrimSpace(string(namespace))
+}
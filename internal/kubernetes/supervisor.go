@@ -0,0 +1,133 @@
+package kubernetes
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/metrics"
+)
+
+const (
+	// Reasons why a watcher is restarted
+	RestartReasonClosed    = "closed"
+	RestartReasonExpired   = "expired"
+	RestartReasonForbidden = "forbidden"
+	RestartReasonNotFound  = "not_found"
+	RestartReasonTransient = "transient"
+
+	// backoffJitter is the maximum ratio of the interval randomly added or subtracted,
+	// so several watchers failing at the same time don't hit the API server at the same time again
+	backoffJitter = 0.2
+
+	watcherClosedMessage    = "%s objects watcher closed. Restarting it in %s"
+	watcherFailedMessage    = "error on %s objects watcher: %s. Restarting it in %s"
+	watcherForbiddenMessage = "error on %s objects watcher: %s. Check RBAC permissions of the exporter. Restarting it in %s"
+	watcherNotFoundMessage  = "error on %s objects watcher: %s. Check that Tekton CRDs are installed. Restarting it in %s"
+)
+
+// SuperviseWatcher run a watcher of a kind of run until the context is done, restarting it when it finishes.
+// Consecutive failures are delayed by an exponential backoff with jitter, defined by 'watch.backoff' configuration.
+// Errors that are not expected to be solved soon (i.e. missing RBAC permissions) are delayed by the maximum interval
+// Hey!, this function is intended to be executed as a go routine
+func SuperviseWatcher(ctx context.Context, kind string, watcher func() error) {
+	interval := time.Duration(0)
+
+	logger := globals.ExecContext.Logger
+	if cluster := getCluster(&ctx); cluster != "" {
+		logger = *logger.With(zap.String("cluster", cluster))
+	}
+
+	for {
+		startTime := time.Now()
+		err := watcher()
+		if ctx.Err() != nil {
+			return
+		}
+
+		backoffConfig := config.Current().Watch.Backoff
+		reason := GetRestartReason(err)
+		metrics.WatcherRestarts.WithLabelValues(kind, reason).Inc()
+
+		// Watchers that were running for a while are considered recovered, so backoff starts from scratch
+		if time.Since(startTime) > backoffConfig.MaxInterval {
+			interval = 0
+		}
+
+		switch reason {
+		case RestartReasonForbidden, RestartReasonNotFound:
+			interval = backoffConfig.MaxInterval
+
+		case RestartReasonClosed, RestartReasonExpired:
+			// These are expected from time to time, so they are only delayed when they happen in a loop
+			if interval != 0 {
+				interval = getNextInterval(interval, backoffConfig)
+			}
+
+		default:
+			interval = getNextInterval(interval, backoffConfig)
+		}
+
+		delay := getJitteredInterval(interval, backoffConfig)
+		switch reason {
+		case RestartReasonClosed, RestartReasonExpired:
+			logger.Infof(watcherClosedMessage, kind, delay)
+		case RestartReasonForbidden:
+			logger.Errorf(watcherForbiddenMessage, kind, err, delay)
+		case RestartReasonNotFound:
+			logger.Errorf(watcherNotFoundMessage, kind, err, delay)
+		default:
+			logger.Errorf(watcherFailedMessage, kind, err, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// GetRestartReason classify the error returned by a watcher into the reason of its restart
+func GetRestartReason(err error) string {
+	switch {
+	case err == nil:
+		return RestartReasonClosed
+	case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+		return RestartReasonExpired
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		return RestartReasonForbidden
+	case apierrors.IsNotFound(err):
+		return RestartReasonNotFound
+	default:
+		return RestartReasonTransient
+	}
+}
+
+// getNextInterval return the interval following the given one: the initial one, or the double, up to the maximum
+func getNextInterval(interval time.Duration, backoffConfig config.BackoffConfig) time.Duration {
+	if interval < backoffConfig.InitialInterval {
+		return backoffConfig.InitialInterval
+	}
+
+	interval *= 2
+	if interval > backoffConfig.MaxInterval {
+		interval = backoffConfig.MaxInterval
+	}
+	return interval
+}
+
+// getJitteredInterval return the interval randomly increased or decreased by backoffJitter, up to the maximum
+func getJitteredInterval(interval time.Duration, backoffConfig config.BackoffConfig) time.Duration {
+	interval = time.Duration(float64(interval) * (1 + backoffJitter*(2*rand.Float64()-1)))
+	if interval > backoffConfig.MaxInterval {
+		interval = backoffConfig.MaxInterval
+	}
+	return interval
+}
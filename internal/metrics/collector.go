@@ -0,0 +1,291 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+// Collector is a Prometheus collector that renders metrics at scrape time
+// from the runs kept in a store and the aggregated outcomes of completed runs
+type Collector struct {
+	store *store.Store
+
+	// Following fields depend on the options, so they are replaced on each reconfiguration
+	mutex                 sync.RWMutex
+	descriptors           descriptorsSpec
+	infoLabels            []string
+	seriesLabels          []string
+	populatedLabelSources map[string]string
+	relabel               []config.RelabelConfig
+	clusterLabel          bool
+
+	pipelineFlakiness   *FlakinessTracker
+	taskFlakiness       *FlakinessTracker
+	dora                *DoraTracker
+	succeededAfterRetry *CounterTracker
+}
+
+// NewCollector return a new Collector that renders metrics from the runs in runStore
+func NewCollector(runStore *store.Store, options CollectorOptions) *Collector {
+	collector := &Collector{
+		store: runStore,
+
+		pipelineFlakiness:   NewFlakinessTracker(options.FlakinessWindowSize),
+		taskFlakiness:       NewFlakinessTracker(options.FlakinessWindowSize),
+		dora:                NewDoraTracker(),
+		succeededAfterRetry: NewCounterTracker(),
+	}
+
+	collector.Reconfigure(options)
+	return collector
+}
+
+// Reconfigure change the metrics rendered by the Collector, keeping the stored runs and aggregated outcomes.
+// As descriptors may change, registered Collectors must be reconfigured through Registry.Reconfigure
+func (c *Collector) Reconfigure(options CollectorOptions) {
+	infoLabels, seriesLabels := getPlacedLabels(options)
+	c.reconfigure(options, infoLabels, seriesLabels, getDescriptors(options, infoLabels, seriesLabels))
+}
+
+// reconfigure replace the fields depending on the options with the already built ones
+func (c *Collector) reconfigure(options CollectorOptions, infoLabels, seriesLabels []string, descriptors descriptorsSpec) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.descriptors = descriptors
+	c.infoLabels = infoLabels
+	c.seriesLabels = seriesLabels
+	c.populatedLabelSources = getPopulatedLabelSources(options)
+	c.relabel = options.Relabel
+	c.clusterLabel = options.ClusterLabel
+
+	c.store.SetCompletedRunsTTL(options.CompletedRunsTTL)
+	c.pipelineFlakiness.SetWindowSize(options.FlakinessWindowSize)
+	c.taskFlakiness.SetWindowSize(options.FlakinessWindowSize)
+}
+
+// UpdateRun store the latest state of a run.
+// When the run is completed for the first time, its outcome is accounted on aggregated metrics.
+// Runs already purged by their TTL are ignored, as their outcome was already accounted
+func (c *Collector) UpdateRun(run store.Run) {
+	previous, found, expired := c.store.Upsert(run)
+
+	if expired || !run.IsCompleted() || (found && previous.IsCompleted()) {
+		return
+	}
+
+	c.recordCompletion(run)
+}
+
+// DeleteRun remove a run, so its metrics are not rendered anymore
+func (c *Collector) DeleteRun(run store.Run) {
+	c.store.Delete(run)
+}
+
+// DeleteRunsFunc remove all the runs for which shouldDelete return true, so their metrics are not rendered anymore
+func (c *Collector) DeleteRunsFunc(shouldDelete func(run *store.Run) bool) {
+	c.store.DeleteFunc(shouldDelete)
+}
+
+// recordCompletion account the outcome of a completed run on aggregated metrics.
+// Outcomes are always recorded, even for disabled metrics, so enabling them later does not start from scratch.
+// Identities always start by the cluster, which is only rendered when the cluster label is enabled
+func (c *Collector) recordCompletion(run store.Run) {
+	switch run.Kind {
+	case tekton.PipelineRunKind:
+		// Update the flakiness of the pipeline with the outcome of this run
+		c.pipelineFlakiness.Record([]string{run.Cluster, run.Namespace, run.Pipeline}, run.IsSucceeded(), run.CompletionTime)
+
+		// Update DORA metrics of the deployed service
+		if run.DeploymentService != "" {
+			c.dora.Record([]string{run.Cluster, run.Namespace, run.DeploymentService}, run.IsSucceeded(), run.CompletionTime.Unix())
+		}
+
+	case tekton.TaskRunKind:
+		// Detect flaky tasks: those that succeeded only after retrying them
+		if run.IsSucceeded() && run.Retries > 0 {
+			c.succeededAfterRetry.Inc(run.Cluster, run.Namespace, run.Task)
+		}
+
+		// Update the flakiness of the task with the outcome of this run
+		c.taskFlakiness.Record([]string{run.Cluster, run.Namespace, run.Pipeline, run.Task}, run.IsSucceeded(), run.CompletionTime)
+	}
+}
+
+// Describe send the descriptors of all the metrics rendered by the Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	c.descriptors.Describe(ch)
+}
+
+// Collect render the metrics from the current state of the runs and aggregated outcomes
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	// Metrics from runs
+	for _, run := range c.store.List() {
+		c.collectRun(ch, &run)
+	}
+
+	// Metrics from aggregated outcomes
+	if c.descriptors.TaskRunSucceededAfterRetry != nil {
+		for _, entry := range c.succeededAfterRetry.Snapshot() {
+			ch <- prometheus.MustNewConstMetric(c.descriptors.TaskRunSucceededAfterRetry,
+				prometheus.CounterValue, entry.Value, c.getIdentityLabelValues(entry.LabelValues)...)
+		}
+	}
+
+	if c.descriptors.PipelineSuccessRate != nil {
+		for _, entry := range c.pipelineFlakiness.Snapshot() {
+			c.collectFlakiness(ch, entry, c.descriptors.PipelineSuccessRate,
+				c.descriptors.PipelineFailureStreak, c.descriptors.PipelineFlipRate)
+		}
+
+		for _, entry := range c.taskFlakiness.Snapshot() {
+			c.collectFlakiness(ch, entry, c.descriptors.TaskSuccessRate,
+				c.descriptors.TaskFailureStreak, c.descriptors.TaskFlipRate)
+		}
+	}
+
+	if c.descriptors.DoraDeployments != nil {
+		for _, entry := range c.dora.Snapshot() {
+			entry.LabelValues = c.getIdentityLabelValues(entry.LabelValues)
+			ch <- prometheus.MustNewConstMetric(c.descriptors.DoraDeployments, prometheus.CounterValue,
+				float64(entry.Score.Deployments-entry.Score.FailedDeployments), concatLabels(entry.LabelValues, []string{"success"})...)
+			ch <- prometheus.MustNewConstMetric(c.descriptors.DoraDeployments, prometheus.CounterValue,
+				float64(entry.Score.FailedDeployments), concatLabels(entry.LabelValues, []string{"failed"})...)
+			ch <- prometheus.MustNewConstMetric(c.descriptors.DoraChangeFailureRate, prometheus.GaugeValue,
+				entry.Score.ChangeFailureRate, entry.LabelValues...)
+
+			// Time to restore is meaningless until the service has failed and recovered
+			if entry.Score.Restored {
+				ch <- prometheus.MustNewConstMetric(c.descriptors.DoraMeanTimeToRestore, prometheus.GaugeValue,
+					entry.Score.MeanTimeToRestore, entry.LabelValues...)
+			}
+		}
+	}
+}
+
+// collectRun render the metrics of a run
+func (c *Collector) collectRun(ch chan<- prometheus.Metric, run *store.Run) {
+	kindDescriptors, found := c.descriptors.RunKinds[run.Kind]
+	if !found {
+		return
+	}
+
+	populatedLabels := c.getPopulatedLabels(run)
+	joinLabelValues := c.getIdentityLabelValues([]string{run.Cluster, run.Name, run.Namespace, run.UID})
+	seriesLabelValues := getLabelValues(populatedLabels, c.seriesLabels)
+
+	runStatusValue := 0.0
+	if run.IsSucceeded() {
+		runStatusValue = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(kindDescriptors.Info, prometheus.GaugeValue, 1,
+		concatLabels(joinLabelValues, getLabelValues(populatedLabels, c.infoLabels))...)
+
+	ch <- prometheus.MustNewConstMetric(kindDescriptors.Status, prometheus.GaugeValue, runStatusValue,
+		concatLabels(joinLabelValues, []string{run.Status, run.Reason}, seriesLabelValues)...)
+
+	ch <- prometheus.MustNewConstMetric(kindDescriptors.Duration, prometheus.GaugeValue, run.Duration(),
+		concatLabels(joinLabelValues, []string{getTimestampLabelValue(run.StartTime),
+			getTimestampLabelValue(run.CompletionTime)}, seriesLabelValues)...)
+
+	if kindDescriptors.Retries != nil {
+		ch <- prometheus.MustNewConstMetric(kindDescriptors.Retries, prometheus.GaugeValue, float64(run.Retries),
+			concatLabels(joinLabelValues, []string{run.Task}, seriesLabelValues)...)
+	}
+
+	if kindDescriptors.GitInfo != nil && run.GitLabels != nil {
+		ch <- prometheus.MustNewConstMetric(kindDescriptors.GitInfo, prometheus.GaugeValue, 1,
+			concatLabels(joinLabelValues, getLabelValues(run.GitLabels, []string{"repository", "revision", "branch"}))...)
+	}
+}
+
+// GetPopulatedLabels return the populated labels of a run, with names in Prometheus syntax,
+// so other outputs can label the run the same way metrics do
+func (c *Collector) GetPopulatedLabels(run *store.Run) map[string]string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.getPopulatedLabels(run)
+}
+
+// getPopulatedLabels return the populated labels of a run, with names in Prometheus syntax.
+// Labels not present in the object are not returned, so they are rendered with '#'
+func (c *Collector) getPopulatedLabels(run *store.Run) (populatedLabels map[string]string) {
+	populatedLabels = make(map[string]string, len(c.populatedLabelSources)+len(c.relabel))
+
+	// Fill only the labels requested by the user
+	for promLabelName, objectLabelName := range c.populatedLabelSources {
+		if labelValue, found := run.Labels[objectLabelName]; found {
+			populatedLabels[promLabelName] = labelValue
+		}
+	}
+
+	// Craft relabelled labels. Later rules override earlier ones for the same target
+	for _, rule := range c.relabel {
+		if labelValue, matched := rule.Apply(run.Labels); matched {
+			populatedLabels[rule.TargetLabel] = labelValue
+		}
+	}
+
+	return populatedLabels
+}
+
+// collectFlakiness render the flakiness metrics of an identity
+func (c *Collector) collectFlakiness(ch chan<- prometheus.Metric, entry FlakinessEntry,
+	successRateDesc, failureStreakDesc, flipRateDesc *prometheus.Desc) {
+
+	entry.LabelValues = c.getIdentityLabelValues(entry.LabelValues)
+
+	ch <- prometheus.MustNewConstMetric(successRateDesc, prometheus.GaugeValue,
+		entry.Score.SuccessRate, entry.LabelValues...)
+	ch <- prometheus.MustNewConstMetric(failureStreakDesc, prometheus.GaugeValue,
+		float64(entry.Score.FailureStreak), entry.LabelValues...)
+	ch <- prometheus.MustNewConstMetric(flipRateDesc, prometheus.GaugeValue,
+		entry.Score.FlipRate, entry.LabelValues...)
+}
+
+// getIdentityLabelValues return the label values identifying a run or an aggregation, which start by the cluster.
+// The cluster is dropped when the cluster label is not enabled
+func (c *Collector) getIdentityLabelValues(labelValues []string) []string {
+	if c.clusterLabel {
+		return labelValues
+	}
+	return labelValues[1:]
+}
+
+// getLabelValues return the values of the requested labels, in the same order.
+// Missing labels are populated with '#'
+func getLabelValues(labels map[string]string, labelNames []string) (values []string) {
+	values = make([]string, 0, len(labelNames))
+	for _, labelName := range labelNames {
+		value, found := labels[labelName]
+		if !found {
+			value = "#"
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// getTimestampLabelValue return a timestamp expressed in seconds since epoch, or '#' when it is missing
+func getTimestampLabelValue(timestamp time.Time) string {
+	if timestamp.IsZero() {
+		return "#"
+	}
+	return strconv.FormatInt(timestamp.Unix(), 10)
+}
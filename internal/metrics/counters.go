@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// CounterEntry represents the value of a counter, identified by its label values
+type CounterEntry struct {
+	LabelValues []string
+	Value       float64
+}
+
+// CounterTracker keeps monotonic counters per set of label values.
+// They outlive the runs they come from, so they are not stored with them
+type CounterTracker struct {
+	mutex    sync.Mutex
+	counters map[string]*CounterEntry
+}
+
+// NewCounterTracker return a new empty CounterTracker
+func NewCounterTracker() *CounterTracker {
+	return &CounterTracker{
+		counters: make(map[string]*CounterEntry),
+	}
+}
+
+// Inc increment by one the counter identified by the label values
+func (t *CounterTracker) Inc(labelValues ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := strings.Join(labelValues, "/")
+
+	counter, found := t.counters[key]
+	if !found {
+		counter = &CounterEntry{LabelValues: labelValues}
+		t.counters[key] = counter
+	}
+
+	counter.Value++
+}
+
+// Snapshot return the current value of all the counters
+func (t *CounterTracker) Snapshot() (entries []CounterEntry) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entries = make([]CounterEntry, 0, len(t.counters))
+	for _, counter := range t.counters {
+		entries = append(entries, *counter)
+	}
+
+	return entries
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxRecentDeployments is the amount of latest deployments per service kept sorted by completion time,
+// so deployments received out of order (i.e. on relists) are placed where they belong to compute restorations
+const maxRecentDeployments = 100
+
+// DoraScore represents the delivery performance of a service, following DORA metrics
+type DoraScore struct {
+	// Deployments and FailedDeployments are the amount of completed deployments
+	Deployments       int
+	FailedDeployments int
+
+	// ChangeFailureRate is the ratio of failed deployments
+	ChangeFailureRate float64
+
+	// MeanTimeToRestore is the average of seconds lasted between a failed deployment and the next successful one
+	MeanTimeToRestore float64
+
+	// Restored is true when the service has been restored at least once
+	Restored bool
+}
+
+// DoraEntry represents the score of a service, identified by its label values
+type DoraEntry struct {
+	LabelValues []string
+	Score       DoraScore
+}
+
+// DoraTracker keeps the deployment history of services to compute DORA metrics
+type DoraTracker struct {
+	mutex    sync.Mutex
+	services map[string]*deploymentHistory
+}
+
+// deploymentHistory represents the accumulated deployments of a service.
+// Restorations depend on the order of the deployments, so the latest ones are kept sorted by completion time
+// and only settled into the restorations once they are too old to be preceded by new ones
+type deploymentHistory struct {
+	labelValues []string
+
+	deployments       int
+	failedDeployments int
+
+	settled      restorationState
+	settledUntil int64
+	recent       []deployment
+}
+
+// deployment represents a completed deployment, expressing its completion in seconds since epoch
+type deployment struct {
+	completionTimestamp int64
+	success             bool
+}
+
+// restorationState represents the restorations of a service up to a deployment
+type restorationState struct {
+	failingSince       int64
+	restorations       int
+	restorationSeconds int64
+}
+
+// NewDoraTracker return a new empty DoraTracker
+func NewDoraTracker() *DoraTracker {
+	return &DoraTracker{
+		services: make(map[string]*deploymentHistory),
+	}
+}
+
+// Record add a completed deployment of a service to its history and return its updated score.
+// Services are defined by the values of the labels they are exposed with.
+// The completion timestamp is expressed in seconds since epoch.
+// Deployments can be received in any order. Those older than the settled ones are only counted
+func (t *DoraTracker) Record(labelValues []string, success bool, completionTimestamp int64) DoraScore {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	service := strings.Join(labelValues, "/")
+
+	history, found := t.services[service]
+	if !found {
+		history = &deploymentHistory{labelValues: labelValues}
+		t.services[service] = history
+	}
+
+	history.deployments++
+	if !success {
+		history.failedDeployments++
+	}
+
+	if completionTimestamp < history.settledUntil {
+		return history.score()
+	}
+
+	// Deployments completed at the same time are kept in arrival order
+	position := sort.Search(len(history.recent), func(index int) bool {
+		return history.recent[index].completionTimestamp > completionTimestamp
+	})
+
+	history.recent = append(history.recent, deployment{})
+	copy(history.recent[position+1:], history.recent[position:])
+	history.recent[position] = deployment{completionTimestamp: completionTimestamp, success: success}
+
+	// Settle the oldest deployment when there are too many
+	if len(history.recent) > maxRecentDeployments {
+		history.settled.apply(history.recent[0])
+		history.settledUntil = history.recent[0].completionTimestamp
+		history.recent = history.recent[1:]
+	}
+
+	return history.score()
+}
+
+// apply update the restorations with the next deployment in completion order
+func (s *restorationState) apply(next deployment) {
+	switch {
+	// The service starts failing with this deployment
+	case !next.success && s.failingSince == 0:
+		s.failingSince = next.completionTimestamp
+
+	// The service is restored by this deployment
+	case next.success && s.failingSince != 0:
+		s.restorations++
+		s.restorationSeconds += next.completionTimestamp - s.failingSince
+		s.failingSince = 0
+	}
+}
+
+// Snapshot return the current score of all the services
+func (t *DoraTracker) Snapshot() (entries []DoraEntry) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entries = make([]DoraEntry, 0, len(t.services))
+	for _, history := range t.services {
+		entries = append(entries, DoraEntry{
+			LabelValues: history.labelValues,
+			Score:       history.score(),
+		})
+	}
+
+	return entries
+}
+
+// score compute the DORA score for the history of a service, replaying the recent deployments on the settled ones
+func (h *deploymentHistory) score() (score DoraScore) {
+	score.Deployments = h.deployments
+	score.FailedDeployments = h.failedDeployments
+	score.ChangeFailureRate = float64(h.failedDeployments) / float64(h.deployments)
+
+	state := h.settled
+	for _, recentDeployment := range h.recent {
+		state.apply(recentDeployment)
+	}
+
+	if state.restorations > 0 {
+		score.Restored = true
+		score.MeanTimeToRestore = float64(state.restorationSeconds) / float64(state.restorations)
+	}
+
+	return score
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestDoraTrackerOutOfOrderDeployments(t *testing.T) {
+	labelValues := []string{"", "ci", "checkout"}
+
+	// Deployments by completion time: failure at 100, failure at 150, success at 200, failure at 300, success at 400
+	deployments := []struct {
+		completionTimestamp int64
+		success             bool
+	}{
+		{400, true},
+		{150, false},
+		{200, true},
+		{300, false},
+		{100, false},
+	}
+
+	tracker := NewDoraTracker()
+	for _, deployment := range deployments {
+		tracker.Record(labelValues, deployment.success, deployment.completionTimestamp)
+	}
+
+	entries := tracker.Snapshot()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+
+	// Restored after 100s (from 100 to 200) and after 100s (from 300 to 400)
+	expected := DoraScore{
+		Deployments:       5,
+		FailedDeployments: 3,
+		ChangeFailureRate: 0.6,
+		MeanTimeToRestore: 100,
+		Restored:          true,
+	}
+	if entries[0].Score != expected {
+		t.Errorf("expected score %+v, got %+v", expected, entries[0].Score)
+	}
+}
+
+func TestDoraTrackerSettlesOldDeployments(t *testing.T) {
+	labelValues := []string{"", "ci", "checkout"}
+	tracker := NewDoraTracker()
+
+	// Alternate failures and successes lasting 10s each, so every success is a restoration
+	for index := int64(0); index < 2*maxRecentDeployments; index++ {
+		tracker.Record(labelValues, index%2 == 1, index*10)
+	}
+
+	// A deployment older than the settled ones is only counted
+	score := tracker.Record(labelValues, false, 5)
+
+	if score.Deployments != 2*maxRecentDeployments+1 || score.FailedDeployments != maxRecentDeployments+1 {
+		t.Errorf("unexpected amount of deployments: %+v", score)
+	}
+	if score.MeanTimeToRestore != 10 {
+		t.Errorf("expected mean time to restore of 10s, got %v", score.MeanTimeToRestore)
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	//
+	"tekton-exporter/internal/store"
+)
+
+// Following metrics are about the exporter itself, so they are registered in the default registry
+var (
+	// WatcherRestarts counts the restarts of the watchers, by the reason of the restart
+	WatcherRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricsPrefix + "watcher_restarts_total",
+		Help: "Restarts of the watchers of each kind of run, by the reason of the restart",
+	}, []string{"kind", "reason"})
+
+	// WatchEvents counts the events received by the watchers, by type.
+	// Resources processed on the reconciliation done after each (re)start are accounted as 'SYNC'
+	WatchEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricsPrefix + "watch_events_total",
+		Help: "Events received by the watchers of each kind of run, by type",
+	}, []string{"kind", "type"})
+
+	// EventProcessingErrors counts the events that could not be processed, by the reason of the failure
+	EventProcessingErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricsPrefix + "event_processing_errors_total",
+		Help: "Events of each kind of run that could not be processed, by the reason of the failure",
+	}, []string{"kind", "reason"})
+
+	// EventProcessingDuration measures the time spent processing each event
+	EventProcessingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    MetricsPrefix + "event_processing_duration_seconds",
+		Help:    "Seconds spent processing the events of each kind of run",
+		Buckets: []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5},
+	}, []string{"kind"})
+
+	// LastEventTimestamp is the time of the latest event received by the watchers
+	LastEventTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: MetricsPrefix + "last_event_timestamp_seconds",
+		Help: "Timestamp of the latest event received by the watcher of each kind of run",
+	}, []string{"kind"})
+
+	// OutputErrors counts the failures delivering data to outputs other than '/metrics' (i.e. Pushgateway)
+	OutputErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricsPrefix + "output_errors_total",
+		Help: "Failures delivering data to each output, after retrying",
+	}, []string{"output"})
+
+	// Leader is 1 when this replica exports the metrics of the runs. It is always 1 without leader election
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: MetricsPrefix + "leader",
+		Help: "Whether this replica is the leader that exports the metrics of the runs",
+	})
+)
+
+// RegisterExporterMetrics register the metrics about the exporter itself
+func RegisterExporterMetrics(registerer prometheus.Registerer, runStore *store.Store) {
+	registerer.MustRegister(WatcherRestarts, WatchEvents, EventProcessingErrors, EventProcessingDuration,
+		LastEventTimestamp, OutputErrors, Leader, newTrackedRunsCollector(runStore))
+}
+
+// trackedRunsCollector is a Prometheus collector that renders the amount of runs kept in a store at scrape time
+type trackedRunsCollector struct {
+	store *store.Store
+	desc  *prometheus.Desc
+}
+
+// newTrackedRunsCollector return a new trackedRunsCollector for the runs in runStore
+func newTrackedRunsCollector(runStore *store.Store) *trackedRunsCollector {
+	return &trackedRunsCollector{
+		store: runStore,
+		desc: prometheus.NewDesc(MetricsPrefix+"tracked_runs",
+			"Runs of each kind kept in memory to render their metrics", []string{"kind"}, nil),
+	}
+}
+
+// Describe send the descriptor of the metric rendered by the collector
+func (c *trackedRunsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect render the amount of runs of each kind in the store
+func (c *trackedRunsCollector) Collect(ch chan<- prometheus.Metric) {
+	for kind, count := range c.store.CountByKind() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), kind)
+	}
+}
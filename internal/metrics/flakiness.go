@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FlakinessScore represents how reliable a pipeline or a task has been during the last runs
+type FlakinessScore struct {
+	// SuccessRate is the ratio of successful runs in the window
+	SuccessRate float64
+
+	// FailureStreak is the amount of consecutive failed runs up to the latest one
+	FailureStreak int
+
+	// FlipRate is the ratio of transitions between success and failure in the window
+	FlipRate float64
+}
+
+// FlakinessEntry represents the score of an identity, identified by its label values
+type FlakinessEntry struct {
+	LabelValues []string
+	Score       FlakinessScore
+}
+
+// FlakinessTracker keeps a sliding window with the outcomes of the latest runs per identity
+// (i.e. a pipeline or a task inside a pipeline) to compute their flakiness
+type FlakinessTracker struct {
+	windowSize int
+
+	mutex   sync.Mutex
+	windows map[string]*outcomesWindow
+}
+
+// outcomesWindow represents the latest outcomes of an identity, sorted by their completion time
+type outcomesWindow struct {
+	labelValues   []string
+	outcomes      []outcome
+	failureStreak int
+}
+
+// outcome represents the result of a completed run
+type outcome struct {
+	completionTime time.Time
+	success        bool
+}
+
+// NewFlakinessTracker return a new FlakinessTracker that remembers, at most, 'windowSize' outcomes per identity
+func NewFlakinessTracker(windowSize int) *FlakinessTracker {
+	if windowSize < 1 {
+		windowSize = 1
+	}
+
+	return &FlakinessTracker{
+		windowSize: windowSize,
+		windows:    make(map[string]*outcomesWindow),
+	}
+}
+
+// SetWindowSize change the amount of outcomes remembered per identity.
+// Windows are trimmed on their next outcome, so current scores are kept meanwhile
+func (t *FlakinessTracker) SetWindowSize(windowSize int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	t.windowSize = windowSize
+}
+
+// Record add a new outcome to the window of an identity and return its updated score.
+// Identities are defined by the values of the labels they are exposed with.
+// Outcomes are placed by their completion time, as runs are not always received in that order
+// (i.e. on relists). Once the window is full, outcomes older than all of it are ignored on purpose:
+// they would be evicted right away, and must not alter the failure streak, which counts the latest outcomes
+func (t *FlakinessTracker) Record(labelValues []string, success bool, completionTime time.Time) FlakinessScore {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	identity := strings.Join(labelValues, "/")
+
+	window, found := t.windows[identity]
+	if !found {
+		window = &outcomesWindow{labelValues: labelValues}
+		t.windows[identity] = window
+	}
+
+	// Outcomes completed at the same time are kept in arrival order
+	position := sort.Search(len(window.outcomes), func(index int) bool {
+		return window.outcomes[index].completionTime.After(completionTime)
+	})
+
+	// Outcomes older than the whole window are ignored, so it is left untouched
+	if position == 0 && len(window.outcomes) >= t.windowSize {
+		return window.score()
+	}
+
+	window.outcomes = append(window.outcomes, outcome{})
+	copy(window.outcomes[position+1:], window.outcomes[position:])
+	window.outcomes[position] = outcome{completionTime: completionTime, success: success}
+
+	// Drop the oldest outcomes when the window is full
+	if len(window.outcomes) > t.windowSize {
+		window.outcomes = window.outcomes[len(window.outcomes)-t.windowSize:]
+	}
+
+	window.updateFailureStreak(success)
+
+	return window.score()
+}
+
+// Snapshot return the current score of all the identities
+func (t *FlakinessTracker) Snapshot() (entries []FlakinessEntry) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entries = make([]FlakinessEntry, 0, len(t.windows))
+	for _, window := range t.windows {
+		entries = append(entries, FlakinessEntry{
+			LabelValues: window.labelValues,
+			Score:       window.score(),
+		})
+	}
+
+	return entries
+}
+
+// updateFailureStreak update the amount of consecutive failures up to the latest outcome, once a new one is placed.
+// The streak is not limited by the window, as long streaks are the interesting ones
+func (w *outcomesWindow) updateFailureStreak(success bool) {
+	for index := len(w.outcomes) - 1; index >= 0; index-- {
+		if w.outcomes[index].success {
+			w.failureStreak = len(w.outcomes) - 1 - index
+			return
+		}
+	}
+
+	// Every outcome in the window is a failure, so the new one extends the streak coming from older ones
+	if !success {
+		w.failureStreak++
+	}
+}
+
+// score compute the flakiness score for the outcomes in the window
+func (w *outcomesWindow) score() (score FlakinessScore) {
+	successes := 0
+	flips := 0
+
+	for index, outcome := range w.outcomes {
+		if outcome.success {
+			successes++
+		}
+
+		if index > 0 && outcome.success != w.outcomes[index-1].success {
+			flips++
+		}
+	}
+
+	score.SuccessRate = float64(successes) / float64(len(w.outcomes))
+	score.FailureStreak = w.failureStreak
+
+	// A single outcome can not flip
+	if len(w.outcomes) > 1 {
+		score.FlipRate = float64(flips) / float64(len(w.outcomes)-1)
+	}
+
+	return score
+}
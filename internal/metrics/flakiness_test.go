@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlakinessTrackerOrdersOutcomesByCompletionTime(t *testing.T) {
+	baseTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	labelValues := []string{"", "ci", "build"}
+
+	inOrder := NewFlakinessTracker(4)
+	outOfOrder := NewFlakinessTracker(4)
+
+	// Outcomes by completion time: success, failure, failure, success, failure
+	outcomes := []bool{true, false, false, true, false}
+	for index, success := range outcomes {
+		inOrder.Record(labelValues, success, baseTime.Add(time.Duration(index)*time.Minute))
+	}
+
+	// Same outcomes, received in other order. The first one is older than the whole window once it is full
+	for _, index := range []int{4, 2, 3, 1, 0} {
+		outOfOrder.Record(labelValues, outcomes[index], baseTime.Add(time.Duration(index)*time.Minute))
+	}
+
+	expected := FlakinessScore{SuccessRate: 0.25, FailureStreak: 1, FlipRate: 2.0 / 3.0}
+	for name, tracker := range map[string]*FlakinessTracker{"in order": inOrder, "out of order": outOfOrder} {
+		entries := tracker.Snapshot()
+		if len(entries) != 1 {
+			t.Fatalf("%s: expected 1 entry, got %d", name, len(entries))
+		}
+		if entries[0].Score != expected {
+			t.Errorf("%s: expected score %+v, got %+v", name, expected, entries[0].Score)
+		}
+	}
+}
+
+func TestFlakinessTrackerFailureStreakOutlivesWindow(t *testing.T) {
+	baseTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	labelValues := []string{"", "ci", "build"}
+
+	tracker := NewFlakinessTracker(2)
+	tracker.Record(labelValues, true, baseTime)
+	tracker.Record(labelValues, false, baseTime.Add(3*time.Minute))
+	tracker.Record(labelValues, false, baseTime.Add(time.Minute))
+
+	// A late failure placed in the middle of the streak extends it
+	score := tracker.Record(labelValues, false, baseTime.Add(2*time.Minute))
+	if score.FailureStreak != 3 {
+		t.Errorf("expected a failure streak of 3, got %d", score.FailureStreak)
+	}
+}
+
+func TestFlakinessTrackerIgnoresOutcomesOlderThanFullWindow(t *testing.T) {
+	baseTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	labelValues := []string{"", "ci", "build"}
+
+	tracker := NewFlakinessTracker(2)
+	tracker.Record(labelValues, false, baseTime.Add(2*time.Minute))
+	expected := tracker.Record(labelValues, false, baseTime.Add(3*time.Minute))
+
+	// Late outcomes older than the whole window alter neither the window nor the failure streak
+	for _, success := range []bool{true, false} {
+		score := tracker.Record(labelValues, success, baseTime.Add(time.Minute))
+		if score != expected {
+			t.Errorf("expected score %+v after an outcome older than the window, got %+v", expected, score)
+		}
+	}
+
+	if expected.FailureStreak != 2 || expected.SuccessRate != 0 {
+		t.Errorf("unexpected score for a window of failures: %+v", expected)
+	}
+
+	// Outcomes placed inside the window are still recorded, evicting the oldest one
+	score := tracker.Record(labelValues, true, baseTime.Add(150*time.Second))
+	if score.SuccessRate != 0.5 || score.FailureStreak != 1 {
+		t.Errorf("expected the late success to be recorded, got %+v", score)
+	}
+}
@@ -1,10 +1,17 @@
 package metrics
 
 import (
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"golang.org/x/exp/maps"
+	"fmt"
 	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	//
+	"tekton-exporter/internal/config"
 )
 
 const (
@@ -13,10 +20,6 @@ const (
 	MetricsPrefix = "tekton_exporter_"
 )
 
-var (
-	Pool = PoolSpec{}
-)
-
 // GetProcessedLabels accept a list of strings representing an object's labels and return a map
 // whose keys are the input labels, and the values are the same labels with a Prometheus-ready syntax
 func GetProcessedLabels(labelNames []string) (promLabelNames map[string]string, err error) {
@@ -39,45 +42,176 @@ func GetProcessedLabels(labelNames []string) (promLabelNames map[string]string,
 	return promLabelNames, err
 }
 
-// RegisterMetrics register declared metrics with their labels on Prometheus SDK
-func RegisterMetrics(extraLabelNames []string) {
+// getDescriptors return the descriptors of declared metrics with their labels.
+// Extra labels are placed on '_info' metrics, on every series or both, depending on labelsPlacement
+// Disabled metrics have no descriptor
+func getDescriptors(options CollectorOptions, infoLabels, seriesLabels []string) (descriptors descriptorsSpec) {
+
+	// Runs coming from several clusters are told apart by a 'cluster' label on every metric
+	var clusterLabels []string
+	if options.ClusterLabel {
+		clusterLabels = []string{"cluster"}
+	}
+
+	// Every series carries join keys (namespace, name, uid), so extra labels can be joined from '_info' metrics
+	joinLabels := concatLabels(clusterLabels, []string{"name", "namespace", "uid"})
+
+	// Metrics for each kind of run are named after it (i.e. PipelineRun -> tekton_exporter_pipelinerun_*)
+	descriptors.RunKinds = make(map[string]runKindDescriptorsSpec, len(options.RunKinds))
+	for _, runKind := range options.RunKinds {
+		kindPrefix := MetricsPrefix + strings.ToLower(runKind.Kind)
+		kindDescriptors := runKindDescriptorsSpec{}
+
+		// Metrics for _info
+		kindDescriptors.Info = prometheus.NewDesc(kindPrefix+"_info",
+			fmt.Sprintf("Metadata of a %s. Value is always 1", runKind.Kind),
+			concatLabels(joinLabels, infoLabels), nil)
+
+		// Metrics for _status
+		kindDescriptors.Status = prometheus.NewDesc(kindPrefix+"_status",
+			fmt.Sprintf("Status of a %s", runKind.Kind),
+			concatLabels(joinLabels, []string{"status", "reason"}, seriesLabels), nil)
+
+		// Metrics for _duration
+		kindDescriptors.Duration = prometheus.NewDesc(kindPrefix+"_duration_seconds",
+			fmt.Sprintf("Seconds lasted by a %s", runKind.Kind),
+			concatLabels(joinLabels, []string{"start_timestamp", "completion_timestamp"}, seriesLabels), nil)
+
+		// Metrics for _retries
+		if runKind.Retries && options.RetriesEnabled {
+			kindDescriptors.Retries = prometheus.NewDesc(kindPrefix+"_retries",
+				fmt.Sprintf("Retries performed by a %s. Attempts are retries plus one", runKind.Kind),
+				concatLabels(joinLabels, []string{"task"}, seriesLabels), nil)
+		}
+
+		// Metrics for git information.
+		// This is an info metric joined by name, namespace and uid, to keep the cardinality of other metrics in check
+		if runKind.GitInfo && options.GitInfoEnabled {
+			kindDescriptors.GitInfo = prometheus.NewDesc(kindPrefix+"_git_info",
+				fmt.Sprintf("Git repository, revision and branch processed by a %s. Value is always 1", runKind.Kind),
+				concatLabels(joinLabels, []string{"repository", "revision", "branch"}), nil)
+		}
+
+		descriptors.RunKinds[runKind.Kind] = kindDescriptors
+	}
+
+	if options.RetriesEnabled {
+		// Metrics for _succeeded_after_retry on TaskRun resources.
+		// Labels are kept to the minimum as counters outlive the runs they come from
+		descriptors.TaskRunSucceededAfterRetry = prometheus.NewDesc(MetricsPrefix+"taskrun_succeeded_after_retry_total",
+			"TaskRuns that succeeded only after one or more retries",
+			concatLabels(clusterLabels, []string{"namespace", "task"}), nil)
+	}
+
+	if options.FlakinessEnabled {
+		// Metrics for flakiness on pipelines and tasks.
+		// They are computed from the latest completed runs of each one, so run-related labels are not included
+		pipelineFlakinessLabels := concatLabels(clusterLabels, []string{"namespace", "pipeline"})
+		taskFlakinessLabels := concatLabels(clusterLabels, []string{"namespace", "pipeline", "task"})
+
+		descriptors.PipelineSuccessRate = prometheus.NewDesc(MetricsPrefix+"pipeline_success_rate",
+			"Ratio of successful runs of a pipeline in the latest completed runs", pipelineFlakinessLabels, nil)
+
+		descriptors.PipelineFailureStreak = prometheus.NewDesc(MetricsPrefix+"pipeline_failure_streak",
+			"Consecutive failed runs of a pipeline up to the latest one", pipelineFlakinessLabels, nil)
+
+		descriptors.PipelineFlipRate = prometheus.NewDesc(MetricsPrefix+"pipeline_flip_rate",
+			"Ratio of success/failure transitions of a pipeline in the latest completed runs", pipelineFlakinessLabels, nil)
+
+		descriptors.TaskSuccessRate = prometheus.NewDesc(MetricsPrefix+"task_success_rate",
+			"Ratio of successful runs of a task in the latest completed runs", taskFlakinessLabels, nil)
+
+		descriptors.TaskFailureStreak = prometheus.NewDesc(MetricsPrefix+"task_failure_streak",
+			"Consecutive failed runs of a task up to the latest one", taskFlakinessLabels, nil)
+
+		descriptors.TaskFlipRate = prometheus.NewDesc(MetricsPrefix+"task_flip_rate",
+			"Ratio of success/failure transitions of a task in the latest completed runs", taskFlakinessLabels, nil)
+	}
+
+	if options.DoraEnabled {
+		// Metrics for DORA on deployment pipelines.
+		// They are computed per service from the completed deployment PipelineRuns
+		doraLabels := concatLabels(clusterLabels, []string{"namespace", "service"})
+
+		descriptors.DoraDeployments = prometheus.NewDesc(MetricsPrefix+"dora_deployments_total",
+			"Completed deployments of a service. Deployment frequency is its rate",
+			concatLabels(doraLabels, []string{"status"}), nil)
+
+		descriptors.DoraChangeFailureRate = prometheus.NewDesc(MetricsPrefix+"dora_change_failure_rate",
+			"Ratio of failed deployments of a service", doraLabels, nil)
+
+		descriptors.DoraMeanTimeToRestore = prometheus.NewDesc(MetricsPrefix+"dora_mean_time_to_restore_seconds",
+			"Average of seconds lasted by a service between a failed deployment and the next successful one", doraLabels, nil)
+	}
+
+	return descriptors
+}
+
+// Describe send the descriptors that are defined. Along with Collect, it implements prometheus.Collector,
+// so descriptors can be validated by registering them before they are used by a Collector
+func (d descriptorsSpec) Describe(ch chan<- *prometheus.Desc) {
+	descriptors := []*prometheus.Desc{
+		d.TaskRunSucceededAfterRetry,
+		d.PipelineSuccessRate, d.PipelineFailureStreak, d.PipelineFlipRate,
+		d.TaskSuccessRate, d.TaskFailureStreak, d.TaskFlipRate,
+		d.DoraDeployments, d.DoraChangeFailureRate, d.DoraMeanTimeToRestore,
+	}
+
+	for _, kindDescriptors := range d.RunKinds {
+		descriptors = append(descriptors, kindDescriptors.Info, kindDescriptors.Status, kindDescriptors.Duration,
+			kindDescriptors.Retries, kindDescriptors.GitInfo)
+	}
 
-	parsedLabelsMap, _ := GetProcessedLabels(extraLabelNames) // TODO: Handle error
-	parsedLabels := maps.Values(parsedLabelsMap)
+	// Disabled metrics have no descriptor
+	for _, desc := range descriptors {
+		if desc != nil {
+			ch <- desc
+		}
+	}
+}
 
-	// Metrics for _status on PipelineRun resources
-	pipelineRunStatusLabels := []string{"name", "namespace", "status", "reason"}
-	pipelineRunStatusLabels = append(pipelineRunStatusLabels, parsedLabels...)
+// Collect render nothing, as metrics are rendered by the Collector
+func (d descriptorsSpec) Collect(ch chan<- prometheus.Metric) {}
 
-	Pool.PipelineRunStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: MetricsPrefix + "pipelinerun_status",
-		Help: "tbd",
-	}, pipelineRunStatusLabels)
+// getPopulatedLabelSources return the Prometheus-ready names of the populated labels,
+// mapped to the object labels their values come from
+func getPopulatedLabelSources(options CollectorOptions) (sources map[string]string) {
+	sources = make(map[string]string)
 
-	// Metrics for _status on TaskRun resources
-	taskRunStatusLabels := []string{"name", "namespace", "status", "reason"}
-	taskRunStatusLabels = append(taskRunStatusLabels, parsedLabels...)
+	parsedLabelsMap, _ := GetProcessedLabels(options.PopulatedLabels) // TODO: Handle error
+	for objectLabelName, promLabelName := range parsedLabelsMap {
+		sources[promLabelName] = objectLabelName
+	}
 
-	Pool.TaskRunStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: MetricsPrefix + "taskrun_status",
-		Help: "tbd",
-	}, taskRunStatusLabels)
+	return sources
+}
 
-	// Metrics for _duration on PipelineRun resources
-	pipelineRunDurationLabels := []string{"name", "namespace", "start_timestamp", "completion_timestamp"}
-	pipelineRunDurationLabels = append(pipelineRunDurationLabels, parsedLabels...)
+// getPlacedLabels return the Prometheus-ready names of the populated labels (including relabelled ones)
+// placed on '_info' metrics and on every series.
+// Names are sorted, so they are always rendered in the same order
+func getPlacedLabels(options CollectorOptions) (infoLabels, seriesLabels []string) {
 
-	Pool.PipelineRunDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: MetricsPrefix + "pipelinerun_duration_seconds",
-		Help: "tbd",
-	}, pipelineRunDurationLabels)
+	parsedLabels := maps.Keys(getPopulatedLabelSources(options))
+	for _, rule := range options.Relabel {
+		parsedLabels = append(parsedLabels, rule.TargetLabel)
+	}
+	slices.Sort(parsedLabels)
+	parsedLabels = slices.Compact(parsedLabels)
 
-	// Metrics for _duration on TaskRun resources
-	taskRunDurationLabels := []string{"name", "namespace", "start_timestamp", "completion_timestamp"}
-	taskRunDurationLabels = append(taskRunDurationLabels, parsedLabels...)
+	if options.LabelsPlacement != config.LabelsPlacementSeries {
+		infoLabels = parsedLabels
+	}
+	if options.LabelsPlacement != config.LabelsPlacementInfo {
+		seriesLabels = parsedLabels
+	}
 
-	Pool.TaskRunDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: MetricsPrefix + "taskrun_duration_seconds",
-		Help: "tbd",
-	}, taskRunDurationLabels)
+	return infoLabels, seriesLabels
+}
+
+// concatLabels return a new list with all the label names of the given lists
+func concatLabels(labelLists ...[]string) (labels []string) {
+	for _, labelList := range labelLists {
+		labels = append(labels, labelList...)
+	}
+	return labels
 }
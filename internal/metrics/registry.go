@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Registry is a Prometheus gatherer for the metrics rendered by a Collector.
+// Prometheus registries remember the labels of every metric ever registered, so a fresh registry
+// is crafted each time the Collector is reconfigured, as descriptors can change their labels
+type Registry struct {
+	collector *Collector
+	registry  atomic.Pointer[prometheus.Registry]
+
+	// disabled makes the Registry gather nothing (i.e. on replicas that are not the leader)
+	disabled atomic.Bool
+}
+
+// NewRegistry return a new Registry with the collector registered
+func NewRegistry(collector *Collector) (registry *Registry, err error) {
+	registry = &Registry{collector: collector}
+
+	promRegistry := prometheus.NewRegistry()
+	err = promRegistry.Register(collector)
+	if err != nil {
+		return nil, err
+	}
+	registry.registry.Store(promRegistry)
+
+	return registry, nil
+}
+
+// Reconfigure change the metrics rendered by the Collector, and register it again with the new descriptors.
+// Descriptors are built and validated before touching the Collector, so it is kept as it was on errors.
+// Stored runs and aggregated outcomes are kept
+func (r *Registry) Reconfigure(options CollectorOptions) (err error) {
+	infoLabels, seriesLabels := getPlacedLabels(options)
+	descriptors := getDescriptors(options, infoLabels, seriesLabels)
+
+	err = prometheus.NewRegistry().Register(descriptors)
+	if err != nil {
+		return err
+	}
+
+	r.collector.reconfigure(options, infoLabels, seriesLabels, descriptors)
+
+	promRegistry := prometheus.NewRegistry()
+	err = promRegistry.Register(r.collector)
+	if err != nil {
+		return err
+	}
+	r.registry.Store(promRegistry)
+
+	return nil
+}
+
+// SetEnabled enable or disable gathering metrics. Runs are still processed while it is disabled,
+// so metrics are complete as soon as it is enabled again
+func (r *Registry) SetEnabled(enabled bool) {
+	r.disabled.Store(!enabled)
+}
+
+// IsEnabled return true when the Registry gathers metrics
+func (r *Registry) IsEnabled() bool {
+	return !r.disabled.Load()
+}
+
+// Gather implements prometheus.Gatherer
+func (r *Registry) Gather() ([]*dto.MetricFamily, error) {
+	if r.disabled.Load() {
+		return nil, nil
+	}
+	return r.registry.Load().Gather()
+}
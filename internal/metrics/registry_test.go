@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+
+	//
+	"tekton-exporter/internal/store"
+)
+
+func TestRegistryReconfigureKeepsCollectorOnErrors(t *testing.T) {
+	options := CollectorOptions{
+		PopulatedLabels:     []string{"team"},
+		LabelsPlacement:     "info",
+		FlakinessWindowSize: 10,
+		RunKinds:            []RunKindMetrics{{Kind: "PipelineRun"}},
+	}
+
+	collector := NewCollector(store.NewStore(0), options)
+	registry, err := NewRegistry(collector)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	previousDescriptors := collector.descriptors
+	previousInfoLabels := collector.infoLabels
+
+	// Label names can not start by a digit, so descriptors are invalid
+	invalidOptions := options
+	invalidOptions.PopulatedLabels = []string{"1team"}
+
+	err = registry.Reconfigure(invalidOptions)
+	if err == nil {
+		t.Fatalf("expected an error for an invalid label name")
+	}
+
+	if !reflect.DeepEqual(collector.descriptors, previousDescriptors) || !reflect.DeepEqual(collector.infoLabels, previousInfoLabels) {
+		t.Errorf("expected the collector not to be altered, got info labels %v", collector.infoLabels)
+	}
+
+	if _, err = registry.Gather(); err != nil {
+		t.Errorf("expected metrics to be gathered with the previous configuration, got: %v", err)
+	}
+}
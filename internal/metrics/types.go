@@ -1,10 +1,82 @@
 package metrics
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"time"
 
-type PoolSpec struct {
-	PipelineRunStatus   *prometheus.GaugeVec
-	TaskRunStatus       *prometheus.GaugeVec
-	PipelineRunDuration *prometheus.GaugeVec
-	TaskRunDuration     *prometheus.GaugeVec
+	"github.com/prometheus/client_golang/prometheus"
+
+	//
+	"tekton-exporter/internal/config"
+)
+
+// CollectorOptions represents the options used to create or reconfigure a Collector
+type CollectorOptions struct {
+	// PopulatedLabels are the object labels requested by the user to be populated on metrics
+	PopulatedLabels []string
+
+	// LabelsPlacement defines the metrics where populated labels are placed: info, series or both
+	LabelsPlacement string
+
+	// Relabel are rules to craft extra populated labels from the values of object labels
+	Relabel []config.RelabelConfig
+
+	// CompletedRunsTTL is the time completed runs are exposed after their completion. Zero means forever
+	CompletedRunsTTL time.Duration
+
+	// RetriesEnabled, FlakinessEnabled, DoraEnabled and GitInfoEnabled toggle groups of metrics
+	RetriesEnabled   bool
+	FlakinessEnabled bool
+	DoraEnabled      bool
+	GitInfoEnabled   bool
+
+	// FlakinessWindowSize is the amount of latest completed runs considered to compute flakiness
+	FlakinessWindowSize int
+
+	// RunKinds are the kinds of runs whose metrics are rendered
+	RunKinds []RunKindMetrics
+
+	// ClusterLabel adds a 'cluster' label to every metric, to tell apart runs coming from several clusters
+	ClusterLabel bool
+}
+
+// RunKindMetrics represents the set of metrics exposed for a kind of run.
+// Info, status and duration metrics are always exposed
+type RunKindMetrics struct {
+	// Kind is the name of the kind (i.e. PipelineRun). Metric names are derived from it
+	Kind string
+
+	// GitInfo enables '_git_info' metric for the kind
+	GitInfo bool
+
+	// Retries enables '_retries' metric for the kind
+	Retries bool
+}
+
+// runKindDescriptorsSpec represents the descriptors of the metrics exposed for a kind of run.
+// Disabled metrics have no descriptor
+type runKindDescriptorsSpec struct {
+	Info     *prometheus.Desc
+	Status   *prometheus.Desc
+	Duration *prometheus.Desc
+	Retries  *prometheus.Desc
+	GitInfo  *prometheus.Desc
+}
+
+// descriptorsSpec represents the descriptors of all the metrics rendered by the Collector.
+// Disabled metrics have no descriptor
+type descriptorsSpec struct {
+	RunKinds map[string]runKindDescriptorsSpec
+
+	TaskRunSucceededAfterRetry *prometheus.Desc
+
+	PipelineSuccessRate   *prometheus.Desc
+	PipelineFailureStreak *prometheus.Desc
+	PipelineFlipRate      *prometheus.Desc
+	TaskSuccessRate       *prometheus.Desc
+	TaskFailureStreak     *prometheus.Desc
+	TaskFlipRate          *prometheus.Desc
+
+	DoraDeployments       *prometheus.Desc
+	DoraChangeFailureRate *prometheus.Desc
+	DoraMeanTimeToRestore *prometheus.Desc
 }
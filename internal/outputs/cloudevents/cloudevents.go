@@ -0,0 +1,202 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/kubernetes"
+	"tekton-exporter/internal/metrics"
+)
+
+const (
+	// outputName identifies this output on exporter metrics
+	outputName = "cloudevents"
+
+	// flushTimeout is the maximum time waited for queued events to be delivered on shutdown
+	flushTimeout = 10 * time.Second
+
+	// requestTimeout is the maximum time waited for each request to a sink
+	requestTimeout = 30 * time.Second
+
+	maxErrorBodyLength = 256
+
+	emittingEventsMessage = "Emitting CloudEvents of runs in %s mode with %d workers"
+	queueFullMessage      = "cloudevents queue is full. Discarding event %s of %s/%s"
+	encodeErrorMessage    = "impossible to encode event %s: %w"
+	sendErrorMessage      = "impossible to deliver event %s to %s after %d attempts: %v"
+	sendRetryMessage      = "impossible to deliver event %s to %s. Retrying in %s: %v"
+)
+
+// delivery represents an event waiting to be sent to a sink
+type delivery struct {
+	sink  string
+	event CloudEvent
+}
+
+// Emitter emits CloudEvents over HTTP when runs start, succeed, fail or are cancelled.
+// Events are queued in memory and delivered by several workers, retrying with exponential backoff
+// while failures are recoverable (i.e. network errors, 5xx or 429 responses)
+type Emitter struct {
+	config    config.CloudEventsOutputConfig
+	collector *metrics.Collector
+	client    *http.Client
+	queue     chan delivery
+}
+
+// NewEmitter return a new Emitter. The collector is used to get the populated labels of the runs
+func NewEmitter(collector *metrics.Collector, cloudEventsConfig config.CloudEventsOutputConfig) *Emitter {
+	return &Emitter{
+		config:    cloudEventsConfig,
+		collector: collector,
+		client:    &http.Client{Timeout: requestTimeout},
+		queue:     make(chan delivery, cloudEventsConfig.Queue.Capacity),
+	}
+}
+
+// HandleRunEvent enqueue the event of a transition, when there is a sink for the namespace of the run.
+// It implements kubernetes.RunHandler interface
+func (e *Emitter) HandleRunEvent(ctx *context.Context, event kubernetes.RunEvent) {
+	sink := e.getSink(event.StoreRun.Namespace)
+	if sink == "" {
+		return
+	}
+
+	cloudEvent := newCloudEvent(event, e.collector.GetPopulatedLabels(&event.StoreRun))
+
+	select {
+	case e.queue <- delivery{sink: sink, event: cloudEvent}:
+	default:
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Warnf(queueFullMessage, cloudEvent.Type, event.StoreRun.Namespace, event.StoreRun.Name)
+	}
+}
+
+// Run deliver the queued events until the context is done.
+// On shutdown, queued events are delivered within a bounded period
+// Hey!, this function is intended to be executed as a go routine
+func (e *Emitter) Run(ctx context.Context) {
+	globals.ExecContext.Logger.Infof(emittingEventsMessage, e.config.Mode, e.config.Queue.Workers)
+
+	// Workers are not stopped by the context, so they can deliver the queued events on shutdown
+	sendCtx, cancelSend := context.WithCancel(context.Background())
+	defer cancelSend()
+
+	var workersWaitGroup sync.WaitGroup
+	for index := 0; index < e.config.Queue.Workers; index++ {
+		workersWaitGroup.Add(1)
+		go func() {
+			defer workersWaitGroup.Done()
+			e.runWorker(ctx, sendCtx)
+		}()
+	}
+
+	<-ctx.Done()
+
+	workersDone := make(chan struct{})
+	go func() {
+		workersWaitGroup.Wait()
+		close(workersDone)
+	}()
+
+	// Deliveries in progress are cancelled once the timeout is reached
+	select {
+	case <-workersDone:
+	case <-time.After(flushTimeout):
+		cancelSend()
+		<-workersDone
+	}
+}
+
+// runWorker deliver queued events until the context is done. Then, it delivers the remaining ones and returns
+func (e *Emitter) runWorker(ctx context.Context, sendCtx context.Context) {
+	for {
+		select {
+		case queuedDelivery := <-e.queue:
+			e.deliver(sendCtx, queuedDelivery)
+
+		case <-ctx.Done():
+			for {
+				select {
+				case queuedDelivery := <-e.queue:
+					e.deliver(sendCtx, queuedDelivery)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver send an event to its sink, retrying with exponential backoff while the failure is recoverable.
+// Events are discarded after the maximum amount of attempts
+func (e *Emitter) deliver(ctx context.Context, queuedDelivery delivery) {
+	backoff := e.config.Queue.MinBackoff
+
+	for attempt := 1; ; attempt++ {
+		recoverable, err := e.send(ctx, queuedDelivery)
+		if err == nil {
+			return
+		}
+
+		if !recoverable || attempt >= e.config.Queue.MaxAttempts || ctx.Err() != nil {
+			metrics.OutputErrors.WithLabelValues(outputName).Inc()
+			globals.ExecContext.Logger.Errorf(sendErrorMessage, queuedDelivery.event.ID, queuedDelivery.sink, attempt, err)
+			return
+		}
+
+		globals.ExecContext.Logger.Debugf(sendRetryMessage, queuedDelivery.event.ID, queuedDelivery.sink, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+
+		backoff = min(backoff*2, e.config.Queue.MaxBackoff)
+	}
+}
+
+// send post an event to its sink in the configured mode, returning whether the failure is recoverable
+func (e *Emitter) send(ctx context.Context, queuedDelivery delivery) (recoverable bool, err error) {
+	header := http.Header{}
+	body, err := queuedDelivery.event.encode(header, e.config.Mode == config.CloudEventsModeStructured)
+	if err != nil {
+		return false, fmt.Errorf(encodeErrorMessage, queuedDelivery.event.ID, err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, queuedDelivery.sink, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header = header
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return false, nil
+	}
+
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodyLength))
+	err = fmt.Errorf("unexpected status code %d: %s", response.StatusCode, bytes.TrimSpace(responseBody))
+
+	return response.StatusCode/100 == 5 || response.StatusCode == http.StatusTooManyRequests, err
+}
+
+// getSink return the URL where events of the runs in a namespace are sent, or an empty string when there is none
+func (e *Emitter) getSink(namespace string) string {
+	if sink, found := e.config.NamespaceSinks[namespace]; found {
+		return sink
+	}
+	return e.config.Sink
+}
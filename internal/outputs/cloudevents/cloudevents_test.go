@@ -0,0 +1,88 @@
+package cloudevents
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/kubernetes"
+	"tekton-exporter/internal/metrics"
+)
+
+func TestDeliverRetries(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	tests := []struct {
+		name             string
+		statusCodes      []int
+		expectedAttempts int32
+		expectedErrors   float64
+	}{
+		{
+			name:             "server error",
+			statusCodes:      []int{http.StatusServiceUnavailable, http.StatusAccepted},
+			expectedAttempts: 2,
+		},
+		{
+			name:             "too many requests",
+			statusCodes:      []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			expectedAttempts: 3,
+		},
+		{
+			name:             "client error",
+			statusCodes:      []int{http.StatusBadRequest, http.StatusOK},
+			expectedAttempts: 1,
+			expectedErrors:   1,
+		},
+		{
+			name:             "attempts exhausted",
+			statusCodes:      []int{http.StatusInternalServerError},
+			expectedAttempts: 4,
+			expectedErrors:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Responses are given in order, repeating the last one
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				attempt := int(attempts.Add(1))
+				writer.WriteHeader(test.statusCodes[min(attempt, len(test.statusCodes))-1])
+			}))
+			defer server.Close()
+
+			emitter := NewEmitter(nil, config.CloudEventsOutputConfig{
+				Mode: config.CloudEventsModeBinary,
+				Queue: config.CloudEventsQueueConfig{
+					MaxAttempts: 4,
+					MinBackoff:  time.Millisecond,
+					MaxBackoff:  5 * time.Millisecond,
+				},
+			})
+
+			previousErrors := testutil.ToFloat64(metrics.OutputErrors.WithLabelValues(outputName))
+			cloudEvent := newCloudEvent(newTestEvent(kubernetes.RunTransitionStarted, "", ""), nil)
+
+			emitter.deliver(context.Background(), delivery{sink: server.URL, event: cloudEvent})
+
+			if attempts.Load() != test.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", test.expectedAttempts, attempts.Load())
+			}
+
+			accountedErrors := testutil.ToFloat64(metrics.OutputErrors.WithLabelValues(outputName)) - previousErrors
+			if accountedErrors != test.expectedErrors {
+				t.Errorf("expected %v errors to be accounted, got %v", test.expectedErrors, accountedErrors)
+			}
+		})
+	}
+}
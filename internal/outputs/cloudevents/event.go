@@ -0,0 +1,210 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	//
+	"tekton-exporter/internal/kubernetes"
+	"tekton-exporter/internal/tekton"
+)
+
+const (
+	specVersion = "1.0"
+
+	// eventTypePrefix is the prefix of the type of the events, which is followed by '<kind>.<outcome>.v1'.
+	// It differs from the one of Tekton's own events, so both can be told apart
+	eventTypePrefix = "dev.tekton.exporter."
+
+	// unknownValue is the value of the store for unknown pipelines and tasks, which is omitted on events
+	unknownValue = "#"
+
+	contentTypeJSON       = "application/json"
+	contentTypeCloudEvent = "application/cloudevents+json; charset=utf-8"
+)
+
+// Following are the outcomes of the runs that are emitted as events
+const (
+	outcomeStarted   = "started"
+	outcomeSucceeded = "succeeded"
+	outcomeFailed    = "failed"
+	outcomeCancelled = "cancelled"
+)
+
+// CloudEvent represents an event about a run, following CloudEvents v1.0 specification.
+// It is the JSON envelope of structured mode, while its attributes are sent as 'ce-*' headers in binary mode
+// Ref: https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            RunData   `json:"data"`
+}
+
+// RunData represents the run an event is about, enriched with its populated labels and computed durations
+type RunData struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+
+	// Pipeline and Task are the names of the pipeline and task the run belongs to, when known
+	Pipeline string `json:"pipeline,omitempty"`
+	Task     string `json:"task,omitempty"`
+
+	// Status, Reason and Message are only present once the run is completed
+	Status  string `json:"status,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	StartTime      *time.Time `json:"startTime,omitempty"`
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+
+	// QueuedSeconds is the time waited by the run between its creation and its start.
+	// DurationSeconds is the time lasted by the run, only present once it is completed
+	QueuedSeconds   *float64 `json:"queuedSeconds,omitempty"`
+	DurationSeconds *float64 `json:"durationSeconds,omitempty"`
+
+	Retries int `json:"retries"`
+
+	// Git contains 'repository', 'revision' and 'branch' of the code processed by the run, when found
+	Git map[string]string `json:"git,omitempty"`
+
+	// Labels are the populated labels of the run, named as on metrics
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// newCloudEvent return the event of a transition of a run.
+// Its ID is derived from the run and its outcome, so receivers can discard duplicates
+func newCloudEvent(event kubernetes.RunEvent, populatedLabels map[string]string) (cloudEvent CloudEvent) {
+	storeRun := event.StoreRun
+	outcome := getOutcome(event)
+
+	cloudEvent = CloudEvent{
+		SpecVersion:     specVersion,
+		ID:              storeRun.UID + "." + outcome,
+		Source:          getSource(event),
+		Type:            eventTypePrefix + strings.ToLower(storeRun.Kind) + "." + outcome + ".v1",
+		Subject:         storeRun.Name,
+		Time:            getEventTime(event),
+		DataContentType: contentTypeJSON,
+		Data: RunData{
+			Cluster:   storeRun.Cluster,
+			Kind:      storeRun.Kind,
+			Namespace: storeRun.Namespace,
+			Name:      storeRun.Name,
+			UID:       storeRun.UID,
+			Retries:   storeRun.Retries,
+			Git:       storeRun.GitLabels,
+			Labels:    populatedLabels,
+		},
+	}
+
+	if storeRun.Pipeline != unknownValue {
+		cloudEvent.Data.Pipeline = storeRun.Pipeline
+	}
+	if storeRun.Task != unknownValue {
+		cloudEvent.Data.Task = storeRun.Task
+	}
+
+	if !storeRun.StartTime.IsZero() {
+		startTime := storeRun.StartTime
+		cloudEvent.Data.StartTime = &startTime
+
+		if event.Run != nil && !event.Run.Metadata.CreationTimestamp.IsZero() {
+			queuedSeconds := startTime.Sub(event.Run.Metadata.CreationTimestamp.Time).Seconds()
+			cloudEvent.Data.QueuedSeconds = &queuedSeconds
+		}
+	}
+
+	if event.Transition != kubernetes.RunTransitionCompleted {
+		return cloudEvent
+	}
+
+	completionTime := storeRun.CompletionTime
+	durationSeconds := storeRun.Duration()
+
+	cloudEvent.Data.Status = storeRun.Status
+	cloudEvent.Data.Reason = storeRun.Reason
+	cloudEvent.Data.CompletionTime = &completionTime
+	cloudEvent.Data.DurationSeconds = &durationSeconds
+
+	if event.Run != nil {
+		if condition, found := event.Run.GetCondition(tekton.SucceededConditionType); found {
+			cloudEvent.Data.Message = condition.Message
+		}
+	}
+
+	return cloudEvent
+}
+
+// getOutcome return the outcome of a run on a transition: started, succeeded, failed or cancelled
+func getOutcome(event kubernetes.RunEvent) string {
+	if event.Transition != kubernetes.RunTransitionCompleted {
+		return outcomeStarted
+	}
+
+	if event.StoreRun.IsSucceeded() {
+		return outcomeSucceeded
+	}
+
+	if event.Run != nil && event.Run.IsCancelled() {
+		return outcomeCancelled
+	}
+
+	return outcomeFailed
+}
+
+// getEventTime return when the transition of a run happened, or the current time when it is unknown
+// (i.e. runs without start time), so the 'time' attribute is never zero
+func getEventTime(event kubernetes.RunEvent) time.Time {
+	eventTime := event.StoreRun.StartTime
+	if event.Transition == kubernetes.RunTransitionCompleted {
+		eventTime = event.StoreRun.CompletionTime
+	}
+
+	if eventTime.IsZero() {
+		return time.Now()
+	}
+	return eventTime
+}
+
+// getSource return the path of the run in Kubernetes API, prefixed by its cluster in multi-cluster mode
+// (i.e. '/clusters/east/apis/tekton.dev/v1/namespaces/ci/pipelineruns/build-x7k2p')
+func getSource(event kubernetes.RunEvent) string {
+	storeRun := event.StoreRun
+
+	source := "/apis/tekton.dev/v1/namespaces/" + storeRun.Namespace + "/" + strings.ToLower(storeRun.Kind) + "s/" + storeRun.Name
+	if storeRun.Cluster != "" {
+		source = "/clusters/" + storeRun.Cluster + source
+	}
+
+	return source
+}
+
+// encode return the body of the request sending an event in the given mode, setting its headers.
+// In binary mode, attributes are sent as headers and the body is the data.
+// In structured mode, the body is the whole event
+func (e *CloudEvent) encode(header http.Header, structured bool) (body []byte, err error) {
+	if structured {
+		header.Set("Content-Type", contentTypeCloudEvent)
+		return json.Marshal(e)
+	}
+
+	header.Set("Content-Type", e.DataContentType)
+	header.Set("ce-specversion", e.SpecVersion)
+	header.Set("ce-id", e.ID)
+	header.Set("ce-source", e.Source)
+	header.Set("ce-type", e.Type)
+	header.Set("ce-subject", e.Subject)
+	header.Set("ce-time", e.Time.Format(time.RFC3339Nano))
+
+	return json.Marshal(e.Data)
+}
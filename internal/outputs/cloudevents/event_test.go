@@ -0,0 +1,198 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	//
+	"tekton-exporter/internal/kubernetes"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+var (
+	testCreationTime   = time.Date(2024, 5, 2, 9, 59, 56, 0, time.UTC)
+	testStartTime      = time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	testCompletionTime = time.Date(2024, 5, 2, 10, 3, 12, 0, time.UTC)
+)
+
+// newTestEvent return the event of a transition of a PipelineRun. Completed runs end with the given condition
+func newTestEvent(transition kubernetes.RunTransition, conditionStatus, conditionReason string) kubernetes.RunEvent {
+	run := &tekton.Run{
+		Kind: tekton.PipelineRunKind,
+		Metadata: metav1.ObjectMeta{
+			Name:              "build-x7k2p",
+			Namespace:         "ci",
+			UID:               "5b1c6f0e",
+			CreationTimestamp: metav1.NewTime(testCreationTime),
+		},
+	}
+
+	storeRun := store.Run{
+		Cluster:   "east",
+		Kind:      tekton.PipelineRunKind,
+		Namespace: "ci",
+		Name:      "build-x7k2p",
+		UID:       "5b1c6f0e",
+		Pipeline:  "release",
+		Task:      "#",
+		StartTime: testStartTime,
+	}
+
+	if transition == kubernetes.RunTransitionCompleted {
+		run.Status.Conditions = []tekton.Condition{{
+			Type: tekton.SucceededConditionType, Status: conditionStatus, Reason: conditionReason, Message: "Tasks Completed: 3",
+		}}
+
+		storeRun.CompletionTime = testCompletionTime
+		storeRun.Status = "failed"
+		if conditionStatus == "True" {
+			storeRun.Status = "success"
+		}
+		storeRun.Reason = conditionReason
+	}
+
+	return kubernetes.RunEvent{Transition: transition, Run: run, StoreRun: storeRun}
+}
+
+func TestNewCloudEventOutcomes(t *testing.T) {
+	tests := []struct {
+		name         string
+		event        kubernetes.RunEvent
+		expectedType string
+		expectedID   string
+		expectedTime time.Time
+	}{
+		{
+			name:         "started",
+			event:        newTestEvent(kubernetes.RunTransitionStarted, "", ""),
+			expectedType: "dev.tekton.exporter.pipelinerun.started.v1",
+			expectedID:   "5b1c6f0e.started",
+			expectedTime: testStartTime,
+		},
+		{
+			name:         "succeeded",
+			event:        newTestEvent(kubernetes.RunTransitionCompleted, "True", "Succeeded"),
+			expectedType: "dev.tekton.exporter.pipelinerun.succeeded.v1",
+			expectedID:   "5b1c6f0e.succeeded",
+			expectedTime: testCompletionTime,
+		},
+		{
+			name:         "failed",
+			event:        newTestEvent(kubernetes.RunTransitionCompleted, "False", "Failed"),
+			expectedType: "dev.tekton.exporter.pipelinerun.failed.v1",
+			expectedID:   "5b1c6f0e.failed",
+			expectedTime: testCompletionTime,
+		},
+		{
+			name:         "cancelled",
+			event:        newTestEvent(kubernetes.RunTransitionCompleted, "False", "Cancelled"),
+			expectedType: "dev.tekton.exporter.pipelinerun.cancelled.v1",
+			expectedID:   "5b1c6f0e.cancelled",
+			expectedTime: testCompletionTime,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloudEvent := newCloudEvent(test.event, nil)
+
+			if cloudEvent.Type != test.expectedType || cloudEvent.ID != test.expectedID || !cloudEvent.Time.Equal(test.expectedTime) {
+				t.Errorf("unexpected event: type %s, id %s, time %s", cloudEvent.Type, cloudEvent.ID, cloudEvent.Time)
+			}
+
+			if cloudEvent.Source != "/clusters/east/apis/tekton.dev/v1/namespaces/ci/pipelineruns/build-x7k2p" {
+				t.Errorf("unexpected source: %s", cloudEvent.Source)
+			}
+
+			// The ID only depends on the run and its outcome, so receivers can discard duplicates
+			if duplicate := newCloudEvent(test.event, nil); duplicate.ID != cloudEvent.ID {
+				t.Errorf("expected a stable ID, got %s and %s", cloudEvent.ID, duplicate.ID)
+			}
+
+			if cloudEvent.Data.Pipeline != "release" || cloudEvent.Data.Task != "" || *cloudEvent.Data.QueuedSeconds != 4 {
+				t.Errorf("unexpected data: %+v", cloudEvent.Data)
+			}
+
+			completed := test.event.Transition == kubernetes.RunTransitionCompleted
+			if completed != (cloudEvent.Data.DurationSeconds != nil) || completed != (cloudEvent.Data.Status != "") {
+				t.Errorf("expected duration and status only once completed, got %+v", cloudEvent.Data)
+			}
+		})
+	}
+}
+
+func TestNewCloudEventWithoutStartTime(t *testing.T) {
+	event := newTestEvent(kubernetes.RunTransitionStarted, "", "")
+	event.StoreRun.StartTime = time.Time{}
+
+	beforeTime := time.Now()
+	cloudEvent := newCloudEvent(event, nil)
+
+	// The time of the transition is unknown, so the one it is observed is used
+	if cloudEvent.Time.Before(beforeTime) || cloudEvent.Time.After(time.Now()) {
+		t.Errorf("expected the time of the event to be the current one, got %s", cloudEvent.Time)
+	}
+
+	if cloudEvent.Data.StartTime != nil || cloudEvent.Data.QueuedSeconds != nil {
+		t.Errorf("expected no start time nor queued seconds, got %+v", cloudEvent.Data)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	cloudEvent := newCloudEvent(newTestEvent(kubernetes.RunTransitionCompleted, "False", "Failed"), map[string]string{"team": "payments"})
+
+	// Binary mode sends the attributes as headers, and the data as body
+	header := http.Header{}
+	body, err := cloudEvent.encode(header, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedHeaders := map[string]string{
+		"Content-Type":   "application/json",
+		"Ce-Specversion": "1.0",
+		"Ce-Id":          "5b1c6f0e.failed",
+		"Ce-Source":      "/clusters/east/apis/tekton.dev/v1/namespaces/ci/pipelineruns/build-x7k2p",
+		"Ce-Type":        "dev.tekton.exporter.pipelinerun.failed.v1",
+		"Ce-Subject":     "build-x7k2p",
+		"Ce-Time":        "2024-05-02T10:03:12Z",
+	}
+	for headerName, headerValue := range expectedHeaders {
+		if header.Get(headerName) != headerValue {
+			t.Errorf("expected header %s=%q, got %q", headerName, headerValue, header.Get(headerName))
+		}
+	}
+
+	data := RunData{}
+	if err = json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("impossible to decode data: %v", err)
+	}
+	if data.Name != "build-x7k2p" || data.Status != "failed" || data.Message != "Tasks Completed: 3" || data.Labels["team"] != "payments" {
+		t.Errorf("unexpected data: %+v", data)
+	}
+
+	// Structured mode sends the whole event as body, without attribute headers
+	header = http.Header{}
+	body, err = cloudEvent.encode(header, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if header.Get("Content-Type") != "application/cloudevents+json; charset=utf-8" || header.Get("Ce-Id") != "" {
+		t.Errorf("unexpected headers in structured mode: %v", header)
+	}
+
+	envelope := CloudEvent{}
+	if err = json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("impossible to decode event: %v", err)
+	}
+	if envelope.ID != "5b1c6f0e.failed" || envelope.SpecVersion != "1.0" || envelope.DataContentType != "application/json" ||
+		!envelope.Time.Equal(testCompletionTime) || envelope.Data.Name != "build-x7k2p" {
+		t.Errorf("unexpected event: %+v", envelope)
+	}
+}
@@ -0,0 +1,262 @@
+package eventlog
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/kubernetes"
+	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/tekton"
+)
+
+const (
+	// outputName identifies this output on exporter metrics
+	outputName = "event_log"
+
+	// eventsQueueSize is the amount of completed runs waiting to be written.
+	// When it is full, new ones are discarded, so watchers are never blocked
+	eventsQueueSize = 10000
+
+	// flushTimeout is the maximum time waited for the last completions to be written on shutdown
+	flushTimeout = 10 * time.Second
+
+	// unknownValue is the value of the store for unknown pipelines and tasks, which is omitted on completions
+	unknownValue = "#"
+
+	writingCompletionsMessage = "Writing run completions to %s event log"
+	queueFullMessage          = "event log queue is full. Discarding completion of %s %s/%s"
+	encodeErrorMessage        = "impossible to encode completion of %s %s/%s: %v"
+	writeErrorMessage         = "impossible to write %d run completions to event log: %v"
+	rotateErrorMessage        = "impossible to rotate event log file %s. Writing into the current one until it can be: %v"
+	closeErrorMessage         = "impossible to close event log: %v"
+)
+
+// RunCompletion represents a completed run, as written on each line of the event log
+type RunCompletion struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+
+	// Pipeline and Task are the names of the pipeline and task the run belongs to, when known
+	Pipeline    string      `json:"pipeline,omitempty"`
+	Task        string      `json:"task,omitempty"`
+	PipelineRef *tekton.Ref `json:"pipelineRef,omitempty"`
+	TaskRef     *tekton.Ref `json:"taskRef,omitempty"`
+
+	// Git contains 'repository', 'revision' and 'branch' of the code processed by the run, when found
+	Git map[string]string `json:"git,omitempty"`
+
+	// Status is 'success' or 'failed', and Reason and Message are the ones of the 'Succeeded' condition
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	StartTime       *time.Time `json:"startTime,omitempty"`
+	CompletionTime  time.Time  `json:"completionTime"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	Retries         int        `json:"retries"`
+
+	// Steps are only reported by TaskRuns
+	Steps []StepCompletion `json:"steps,omitempty"`
+
+	// Labels are the populated labels of the run, named as on metrics
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// StepCompletion represents a step of a completed TaskRun. Steps that did not run have no outcome nor timings
+type StepCompletion struct {
+	Name      string `json:"name"`
+	Container string `json:"container,omitempty"`
+
+	ExitCode *int32 `json:"exitCode,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+
+	StartTime       *time.Time `json:"startTime,omitempty"`
+	CompletionTime  *time.Time `json:"completionTime,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds,omitempty"`
+}
+
+// Writer writes a JSON line per completed run into a sink: stdout, a rotating file or an HTTP endpoint.
+// Each completion is written once, as run handlers are notified once per transition
+type Writer struct {
+	config    config.EventLogOutputConfig
+	collector *metrics.Collector
+	queue     chan kubernetes.RunEvent
+	sink      sink
+}
+
+// NewWriter return a new Writer into the sink defined in the configuration.
+// The collector is used to get the populated labels of the runs
+func NewWriter(collector *metrics.Collector, eventLogConfig config.EventLogOutputConfig) (writer *Writer, err error) {
+	writer = &Writer{
+		config:    eventLogConfig,
+		collector: collector,
+		queue:     make(chan kubernetes.RunEvent, eventsQueueSize),
+	}
+
+	switch eventLogConfig.Sink {
+	case config.EventLogSinkFile:
+		writer.sink, err = newFileSink(eventLogConfig.File)
+	case config.EventLogSinkHTTP:
+		writer.sink = newHTTPSink(eventLogConfig.HTTP)
+	default:
+		writer.sink = newStdoutSink()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	globals.ExecContext.Logger.Infof(writingCompletionsMessage, eventLogConfig.Sink)
+	return writer, nil
+}
+
+// HandleRunEvent enqueue completed runs to be written.
+// It implements kubernetes.RunHandler interface
+func (w *Writer) HandleRunEvent(ctx *context.Context, event kubernetes.RunEvent) {
+	if event.Transition != kubernetes.RunTransitionCompleted {
+		return
+	}
+
+	select {
+	case w.queue <- event:
+	default:
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Warnf(queueFullMessage, event.StoreRun.Kind, event.StoreRun.Namespace, event.StoreRun.Name)
+	}
+}
+
+// Run write the queued completions until the context is done. Completions are written in batches
+// of the ones queued at the same time. On shutdown, queued completions are written before closing the sink
+// Hey!, this function is intended to be executed as a go routine
+func (w *Writer) Run(ctx context.Context) {
+	var batch [][]byte
+
+	for {
+		select {
+		case event := <-w.queue:
+			batch = w.appendCompletion(batch, event)
+			if len(w.queue) == 0 || len(batch) >= w.config.HTTP.MaxBatchSize {
+				w.write(ctx, batch)
+				batch = nil
+			}
+
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			defer cancel()
+
+			for len(w.queue) > 0 {
+				batch = w.appendCompletion(batch, <-w.queue)
+				if len(batch) >= w.config.HTTP.MaxBatchSize {
+					w.write(flushCtx, batch)
+					batch = nil
+				}
+			}
+			w.write(flushCtx, batch)
+
+			err := w.sink.close()
+			if err != nil {
+				globals.ExecContext.Logger.Errorf(closeErrorMessage, err)
+			}
+			return
+		}
+	}
+}
+
+// appendCompletion encode the completion of a run as a JSON line, and append it to a batch
+func (w *Writer) appendCompletion(batch [][]byte, event kubernetes.RunEvent) [][]byte {
+	line, err := json.Marshal(w.getRunCompletion(event))
+	if err != nil {
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Errorf(encodeErrorMessage, event.StoreRun.Kind, event.StoreRun.Namespace, event.StoreRun.Name, err)
+		return batch
+	}
+
+	return append(batch, append(line, '\n'))
+}
+
+// write send a batch of lines to the sink. Lines are lost when it fails, so failures are accounted
+func (w *Writer) write(ctx context.Context, batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := w.sink.write(ctx, batch)
+	if err != nil {
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Errorf(writeErrorMessage, len(batch), err)
+	}
+}
+
+// getRunCompletion return the completion of a run, from its normalised version and the object it comes from
+func (w *Writer) getRunCompletion(event kubernetes.RunEvent) (completion RunCompletion) {
+	storeRun := event.StoreRun
+
+	completion = RunCompletion{
+		Cluster:         storeRun.Cluster,
+		Kind:            storeRun.Kind,
+		Namespace:       storeRun.Namespace,
+		Name:            storeRun.Name,
+		UID:             storeRun.UID,
+		Git:             storeRun.GitLabels,
+		Status:          storeRun.Status,
+		Reason:          storeRun.Reason,
+		CompletionTime:  storeRun.CompletionTime,
+		DurationSeconds: storeRun.Duration(),
+		Retries:         storeRun.Retries,
+		Labels:          w.collector.GetPopulatedLabels(&storeRun),
+	}
+
+	if storeRun.Pipeline != unknownValue {
+		completion.Pipeline = storeRun.Pipeline
+	}
+	if storeRun.Task != unknownValue {
+		completion.Task = storeRun.Task
+	}
+	if !storeRun.StartTime.IsZero() {
+		completion.StartTime = &storeRun.StartTime
+	}
+
+	if event.Run == nil {
+		return completion
+	}
+
+	completion.PipelineRef = event.Run.Spec.PipelineRef
+	completion.TaskRef = event.Run.Spec.TaskRef
+
+	if condition, found := event.Run.GetCondition(tekton.SucceededConditionType); found {
+		completion.Message = condition.Message
+	}
+
+	for _, step := range event.Run.Status.Steps {
+		completion.Steps = append(completion.Steps, getStepCompletion(step))
+	}
+
+	return completion
+}
+
+// getStepCompletion return the completion of a step. Only terminated steps have outcome and timings
+func getStepCompletion(step tekton.StepState) (completion StepCompletion) {
+	completion = StepCompletion{Name: step.Name, Container: step.Container}
+
+	if step.Terminated == nil {
+		return completion
+	}
+
+	exitCode := step.Terminated.ExitCode
+	startTime := step.Terminated.StartedAt.Time
+	completionTime := step.Terminated.FinishedAt.Time
+
+	completion.ExitCode = &exitCode
+	completion.Reason = step.Terminated.Reason
+	completion.StartTime = &startTime
+	completion.CompletionTime = &completionTime
+	completion.DurationSeconds = completionTime.Sub(startTime).Seconds()
+
+	return completion
+}
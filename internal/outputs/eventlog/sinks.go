@@ -0,0 +1,218 @@
+package eventlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+)
+
+const (
+	// writeAttempts is the amount of times a batch is posted before giving up.
+	// Attempts are spaced by an exponential backoff starting at retryInitialInterval
+	writeAttempts        = 3
+	retryInitialInterval = time.Second
+
+	// requestTimeout is the maximum time waited for each request to the HTTP endpoint
+	requestTimeout = 30 * time.Second
+
+	maxErrorBodyLength = 256
+)
+
+// sink is a destination of the lines of the event log
+type sink interface {
+	// write append lines, each of them ended by a newline
+	write(ctx context.Context, lines [][]byte) error
+	close() error
+}
+
+// stdoutSink writes lines to the standard output. Logs are written to the standard error, so they are not mixed
+type stdoutSink struct{}
+
+func newStdoutSink() *stdoutSink {
+	return &stdoutSink{}
+}
+
+func (s *stdoutSink) write(ctx context.Context, lines [][]byte) error {
+	_, err := os.Stdout.Write(bytes.Join(lines, nil))
+	return err
+}
+
+func (s *stdoutSink) close() error {
+	return nil
+}
+
+// fileSink appends lines to a file, rotating it when it reaches its maximum size.
+// Rotated files are renamed to '<path>.1', shifting older ones, and the oldest are removed
+type fileSink struct {
+	config  config.EventLogFileConfig
+	maxSize int64
+
+	file *os.File
+	size int64
+}
+
+func newFileSink(fileConfig config.EventLogFileConfig) (*fileSink, error) {
+	fileSink := &fileSink{
+		config:  fileConfig,
+		maxSize: int64(fileConfig.MaxSizeMB) * 1024 * 1024,
+	}
+
+	err := fileSink.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return fileSink, nil
+}
+
+// open open the file for appending, keeping its current size
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = fileInfo.Size()
+	return nil
+}
+
+// write append the lines, rotating the file first when they do not fit into it.
+// When the rotation fails, lines are appended to the current file anyway, and it is rotated again on next writes.
+// Lines are synced to disk, so they are not lost on crashes
+func (s *fileSink) write(ctx context.Context, lines [][]byte) error {
+	content := bytes.Join(lines, nil)
+
+	if s.size > 0 && s.size+int64(len(content)) > s.maxSize {
+		err := s.rotate()
+		if err != nil {
+			globals.ExecContext.Logger.Warnf(rotateErrorMessage, s.config.Path, err)
+		}
+	}
+
+	written, err := s.file.Write(content)
+	s.size += int64(written)
+	if err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+// rotate shift the rotated files, and switch to a new empty file. The current file is only closed once the new
+// one is open, so it stays the one written when any step fails, even if it was already renamed. In that case,
+// there is no file at the path on next rotations, so the new one is just open
+func (s *fileSink) rotate() (err error) {
+	for index := s.config.MaxBackups - 1; index >= 1; index-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", s.config.Path, index), fmt.Sprintf("%s.%d", s.config.Path, index+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if s.config.MaxBackups > 0 {
+		err = os.Rename(s.config.Path, s.config.Path+".1")
+	} else {
+		err = os.Remove(s.config.Path)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	previousFile := s.file
+	err = s.open()
+	if err != nil {
+		return err
+	}
+
+	return previousFile.Close()
+}
+
+func (s *fileSink) close() error {
+	return s.file.Close()
+}
+
+// httpSink posts lines to an HTTP endpoint as newline-delimited JSON, retrying failed requests
+type httpSink struct {
+	config config.EventLogHTTPConfig
+	client *http.Client
+}
+
+func newHTTPSink(httpConfig config.EventLogHTTPConfig) *httpSink {
+	return &httpSink{
+		config: httpConfig,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// write post the lines in a single request. Requests failed by network errors, 5xx or 429 responses
+// are attempted up to writeAttempts times, backing off between attempts
+func (s *httpSink) write(ctx context.Context, lines [][]byte) (err error) {
+	content := bytes.Join(lines, nil)
+	interval := retryInitialInterval
+
+	for attempt := 1; ; attempt++ {
+		var recoverable bool
+		recoverable, err = s.post(ctx, content)
+		if err == nil || !recoverable || attempt == writeAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+			interval *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// post send the content to the endpoint, returning whether the failure is recoverable
+func (s *httpSink) post(ctx context.Context, content []byte) (recoverable bool, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(content))
+	if err != nil {
+		return false, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	for headerName, headerValue := range s.config.Headers {
+		request.Header.Set(headerName, headerValue)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return false, nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodyLength))
+	err = fmt.Errorf("unexpected status code %d: %s", response.StatusCode, bytes.TrimSpace(body))
+
+	return response.StatusCode/100 == 5 || response.StatusCode == http.StatusTooManyRequests, err
+}
+
+func (s *httpSink) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
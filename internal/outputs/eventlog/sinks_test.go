@@ -0,0 +1,63 @@
+package eventlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+)
+
+func TestFileSinkKeepsWritingWhenRotationFails(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+	path := filepath.Join(t.TempDir(), "completions.log")
+
+	sink, err := newFileSink(config.EventLogFileConfig{Path: path, MaxSizeMB: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sink.close()
+
+	// A non-empty directory where the rotated file goes makes the rotation fail
+	if err = os.MkdirAll(filepath.Join(path+".1", "busy"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	firstLine := []byte("{\"name\":\"first\"}\n")
+	sink.size = sink.maxSize
+
+	// Lines are written into the current file anyway
+	if err = sink.write(context.Background(), [][]byte{firstLine}); err != nil {
+		t.Fatalf("unexpected error when rotation fails: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != string(firstLine) {
+		t.Fatalf("expected the current file to contain the line, got %q (%v)", content, err)
+	}
+
+	// The rotation is attempted again on next writes, once it is possible
+	if err = os.RemoveAll(path + ".1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	secondLine := []byte("{\"name\":\"second\"}\n")
+	if err = sink.write(context.Background(), [][]byte{secondLine}); err != nil {
+		t.Fatalf("unexpected error after rotation failure: %v", err)
+	}
+
+	content, err = os.ReadFile(path)
+	if err != nil || string(content) != string(secondLine) {
+		t.Errorf("expected the new file to contain the second line, got %q (%v)", content, err)
+	}
+
+	content, err = os.ReadFile(path + ".1")
+	if err != nil || string(content) != string(firstLine) {
+		t.Errorf("expected the rotated file to contain the first line, got %q (%v)", content, err)
+	}
+}
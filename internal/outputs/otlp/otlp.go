@@ -0,0 +1,109 @@
+package otlp
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+)
+
+const (
+	// ServiceName identifies the exporter on the receiver side
+	ServiceName = "tekton-exporter"
+
+	// flushTimeout is the maximum time waited for the last push on shutdown
+	flushTimeout = 10 * time.Second
+
+	pushingMetricsMessage = "Pushing metrics to OTLP receiver %s (%s) every %s"
+)
+
+// RunMetricsExporter push the metrics gathered from a Gatherer to an OTLP receiver periodically, until the context is done.
+// Metrics are pushed one last time on shutdown, so the latest changes are not lost
+// Hey!, this function is intended to be executed as a go routine
+func RunMetricsExporter(ctx context.Context, gatherer prometheus.Gatherer, otlpConfig config.OTLPOutputConfig) (err error) {
+
+	exporter, err := newMetricExporter(ctx, otlpConfig)
+	if err != nil {
+		return err
+	}
+
+	exporterResource, err := NewResource(ctx, otlpConfig.ResourceAttributes)
+	if err != nil {
+		return err
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(otlpConfig.Interval),
+		sdkmetric.WithProducer(NewGathererProducer(gatherer, ServiceName)))
+
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(exporterResource),
+		sdkmetric.WithReader(reader))
+
+	globals.ExecContext.Logger.Infof(pushingMetricsMessage, otlpConfig.Endpoint, otlpConfig.Protocol, otlpConfig.Interval)
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	return meterProvider.Shutdown(shutdownCtx)
+}
+
+// newMetricExporter return an OTLP exporter for the protocol defined in the configuration
+func newMetricExporter(ctx context.Context, otlpConfig config.OTLPOutputConfig) (sdkmetric.Exporter, error) {
+
+	if otlpConfig.Protocol == config.OTLPProtocolHTTP {
+		options := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(otlpConfig.Endpoint)}
+		if otlpConfig.Insecure {
+			options = append(options, otlpmetrichttp.WithInsecure())
+		}
+		if len(otlpConfig.Headers) > 0 {
+			options = append(options, otlpmetrichttp.WithHeaders(otlpConfig.Headers))
+		}
+
+		return otlpmetrichttp.New(ctx, options...)
+	}
+
+	options := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(otlpConfig.Endpoint)}
+	if otlpConfig.Insecure {
+		options = append(options, otlpmetricgrpc.WithInsecure())
+	}
+	if len(otlpConfig.Headers) > 0 {
+		options = append(options, otlpmetricgrpc.WithHeaders(otlpConfig.Headers))
+	}
+
+	return otlpmetricgrpc.New(ctx, options...)
+}
+
+// NewResource return the resource that identifies the exporter: its service name, its instance
+// (the hostname, which is the name of the pod in Kubernetes) and the attributes defined by the user.
+// Attributes from OTEL_RESOURCE_ATTRIBUTES environment variable take precedence over all of them
+func NewResource(ctx context.Context, resourceAttributes map[string]string) (*resource.Resource, error) {
+	attributes := []attribute.KeyValue{semconv.ServiceName(ServiceName)}
+
+	hostname, err := os.Hostname()
+	if err == nil {
+		attributes = append(attributes, semconv.ServiceInstanceID(hostname))
+	}
+
+	for key, value := range resourceAttributes {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+
+	return resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(attributes...),
+		resource.WithFromEnv())
+}
@@ -0,0 +1,234 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+)
+
+// metricsReceiver is an in-process OTLP receiver that keeps the requests it receives, over gRPC and HTTP
+type metricsReceiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	mutex    sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+}
+
+func (r *metricsReceiver) Export(ctx context.Context, request *collectormetrics.ExportMetricsServiceRequest) (
+	*collectormetrics.ExportMetricsServiceResponse, error) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requests = append(r.requests, request)
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *metricsReceiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil || request.URL.Path != "/v1/metrics" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	exportRequest := &collectormetrics.ExportMetricsServiceRequest{}
+	if err = proto.Unmarshal(body, exportRequest); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	response, _ := r.Export(request.Context(), exportRequest)
+	content, _ := proto.Marshal(response)
+
+	writer.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = writer.Write(content)
+}
+
+// getMetrics return the metrics received, by name, along with the attributes of their resources
+func (r *metricsReceiver) getMetrics() (metrics map[string]*metricspb.Metric, resourceAttributes map[string]string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	metrics = make(map[string]*metricspb.Metric)
+	resourceAttributes = make(map[string]string)
+
+	for _, request := range r.requests {
+		for _, resourceMetrics := range request.GetResourceMetrics() {
+			for _, attribute := range resourceMetrics.GetResource().GetAttributes() {
+				resourceAttributes[attribute.GetKey()] = attribute.GetValue().GetStringValue()
+			}
+
+			for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+				for _, metric := range scopeMetrics.GetMetrics() {
+					metrics[metric.GetName()] = metric
+				}
+			}
+		}
+	}
+
+	return metrics, resourceAttributes
+}
+
+// newTestGatherer return a registry with a metric of each type supported by GathererProducer
+func newTestGatherer() prometheus.Gatherer {
+	registry := prometheus.NewRegistry()
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tekton_exporter_taskrun_succeeded_after_retry_total", Help: "TaskRuns succeeded after retries",
+	}, []string{"namespace", "task"})
+	counter.WithLabelValues("ci", "unit-tests").Add(3)
+
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tekton_exporter_pipelinerun_status", Help: "Status of PipelineRuns",
+	}, []string{"namespace", "name", "status"})
+	gauge.WithLabelValues("ci", "build-x7k2p", "success").Set(1)
+
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "tekton_exporter_event_processing_duration_seconds", Help: "Time processing events",
+		Buckets: []float64{0.1, 1},
+	})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	registry.MustRegister(counter, gauge, histogram)
+	return registry
+}
+
+// exportOnce run the metrics exporter until its push on shutdown is done
+func exportOnce(t *testing.T, otlpConfig config.OTLPOutputConfig) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- RunMetricsExporter(ctx, newTestGatherer(), otlpConfig)
+	}()
+
+	// Metrics are pushed on shutdown, as the interval is never reached
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error exporting metrics: %v", err)
+	}
+}
+
+func assertReceivedMetrics(t *testing.T, receiver *metricsReceiver) {
+	metrics, resourceAttributes := receiver.getMetrics()
+
+	hostname, _ := os.Hostname()
+	expectedAttributes := map[string]string{
+		"service.name":        ServiceName,
+		"service.instance.id": hostname,
+		"k8s.cluster.name":    "east",
+	}
+	for key, value := range expectedAttributes {
+		if resourceAttributes[key] != value {
+			t.Errorf("expected resource attribute %s=%q, got %q", key, value, resourceAttributes[key])
+		}
+	}
+
+	counter := metrics["tekton_exporter_taskrun_succeeded_after_retry_total"]
+	if counter.GetSum() == nil || !counter.GetSum().GetIsMonotonic() ||
+		counter.GetSum().GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Fatalf("expected counter as a cumulative monotonic sum, got %v", counter)
+	}
+	counterPoint := counter.GetSum().GetDataPoints()[0]
+	if counterPoint.GetAsDouble() != 3 || getAttribute(counterPoint.GetAttributes(), "task") != "unit-tests" {
+		t.Errorf("unexpected counter data point: %v", counterPoint)
+	}
+
+	gauge := metrics["tekton_exporter_pipelinerun_status"]
+	if gauge.GetGauge() == nil {
+		t.Fatalf("expected gauge, got %v", gauge)
+	}
+	gaugePoint := gauge.GetGauge().GetDataPoints()[0]
+	if gaugePoint.GetAsDouble() != 1 || getAttribute(gaugePoint.GetAttributes(), "name") != "build-x7k2p" {
+		t.Errorf("unexpected gauge data point: %v", gaugePoint)
+	}
+
+	histogram := metrics["tekton_exporter_event_processing_duration_seconds"]
+	if histogram.GetHistogram() == nil {
+		t.Fatalf("expected histogram, got %v", histogram)
+	}
+	histogramPoint := histogram.GetHistogram().GetDataPoints()[0]
+	if histogramPoint.GetCount() != 3 || histogramPoint.GetSum() != 5.55 {
+		t.Errorf("unexpected histogram count and sum: %v", histogramPoint)
+	}
+	if bounds := histogramPoint.GetExplicitBounds(); len(bounds) != 2 || bounds[0] != 0.1 || bounds[1] != 1 {
+		t.Errorf("unexpected histogram bounds: %v", bounds)
+	}
+	if counts := histogramPoint.GetBucketCounts(); len(counts) != 3 || counts[0] != 1 || counts[1] != 1 || counts[2] != 1 {
+		t.Errorf("unexpected histogram bucket counts: %v", counts)
+	}
+}
+
+func getAttribute(attributes []*commonpb.KeyValue, key string) string {
+	for _, attribute := range attributes {
+		if attribute.GetKey() == key {
+			return attribute.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestRunMetricsExporterGRPC(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("impossible to listen: %v", err)
+	}
+
+	receiver := &metricsReceiver{}
+	server := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(server, receiver)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	exportOnce(t, config.OTLPOutputConfig{
+		Endpoint:           listener.Addr().String(),
+		Protocol:           config.OTLPProtocolGRPC,
+		Insecure:           true,
+		Interval:           time.Hour,
+		ResourceAttributes: map[string]string{"k8s.cluster.name": "east"},
+	})
+
+	assertReceivedMetrics(t, receiver)
+}
+
+func TestRunMetricsExporterHTTP(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	receiver := &metricsReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	exportOnce(t, config.OTLPOutputConfig{
+		Endpoint:           strings.TrimPrefix(server.URL, "http://"),
+		Protocol:           config.OTLPProtocolHTTP,
+		Insecure:           true,
+		Interval:           time.Hour,
+		ResourceAttributes: map[string]string{"k8s.cluster.name": "east"},
+	})
+
+	assertReceivedMetrics(t, receiver)
+}
@@ -0,0 +1,159 @@
+package otlp
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// GathererProducer produces OpenTelemetry metrics from the ones gathered from a Prometheus Gatherer,
+// so the same metrics served on '/metrics' are pushed. Metrics are converted as follows:
+// counters into monotonic sums, gauges into gauges, histograms into histograms and summaries into summaries.
+// All of them are cumulative since the exporter was started
+type GathererProducer struct {
+	gatherer  prometheus.Gatherer
+	scope     instrumentation.Scope
+	startTime time.Time
+}
+
+// NewGathererProducer return a new GathererProducer for a Gatherer
+func NewGathererProducer(gatherer prometheus.Gatherer, scopeName string) *GathererProducer {
+	return &GathererProducer{
+		gatherer:  gatherer,
+		scope:     instrumentation.Scope{Name: scopeName},
+		startTime: time.Now(),
+	}
+}
+
+// Produce return the gathered metrics converted into OpenTelemetry ones.
+// It implements metric.Producer interface from OpenTelemetry SDK
+func (p *GathererProducer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	metricFamilies, err := p.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	scopeMetrics := metricdata.ScopeMetrics{Scope: p.scope}
+
+	for _, metricFamily := range metricFamilies {
+		data := p.getAggregation(metricFamily, now)
+		if data == nil {
+			continue
+		}
+
+		scopeMetrics.Metrics = append(scopeMetrics.Metrics, metricdata.Metrics{
+			Name:        metricFamily.GetName(),
+			Description: metricFamily.GetHelp(),
+			Data:        data,
+		})
+	}
+
+	return []metricdata.ScopeMetrics{scopeMetrics}, nil
+}
+
+// getAggregation return the data points of a metric family, or nil when its type is not supported
+func (p *GathererProducer) getAggregation(metricFamily *dto.MetricFamily, now time.Time) metricdata.Aggregation {
+	switch metricFamily.GetType() {
+	case dto.MetricType_COUNTER:
+		sum := metricdata.Sum[float64]{Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+		for _, metric := range metricFamily.GetMetric() {
+			sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: getAttributes(metric),
+				StartTime:  p.startTime,
+				Time:       now,
+				Value:      metric.GetCounter().GetValue(),
+			})
+		}
+		return sum
+
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		gauge := metricdata.Gauge[float64]{}
+		for _, metric := range metricFamily.GetMetric() {
+			value := metric.GetGauge().GetValue()
+			if metricFamily.GetType() == dto.MetricType_UNTYPED {
+				value = metric.GetUntyped().GetValue()
+			}
+
+			gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: getAttributes(metric),
+				Time:       now,
+				Value:      value,
+			})
+		}
+		return gauge
+
+	case dto.MetricType_HISTOGRAM:
+		histogram := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+		for _, metric := range metricFamily.GetMetric() {
+			histogram.DataPoints = append(histogram.DataPoints, p.getHistogramDataPoint(metric, now))
+		}
+		return histogram
+
+	case dto.MetricType_SUMMARY:
+		summary := metricdata.Summary{}
+		for _, metric := range metricFamily.GetMetric() {
+			dataPoint := metricdata.SummaryDataPoint{
+				Attributes: getAttributes(metric),
+				StartTime:  p.startTime,
+				Time:       now,
+				Count:      metric.GetSummary().GetSampleCount(),
+				Sum:        metric.GetSummary().GetSampleSum(),
+			}
+
+			for _, quantile := range metric.GetSummary().GetQuantile() {
+				dataPoint.QuantileValues = append(dataPoint.QuantileValues, metricdata.QuantileValue{
+					Quantile: quantile.GetQuantile(),
+					Value:    quantile.GetValue(),
+				})
+			}
+			summary.DataPoints = append(summary.DataPoints, dataPoint)
+		}
+		return summary
+	}
+
+	return nil
+}
+
+// getHistogramDataPoint convert a Prometheus histogram into an OpenTelemetry one.
+// Prometheus buckets are cumulative, while OpenTelemetry ones count only the values inside each bucket
+func (p *GathererProducer) getHistogramDataPoint(metric *dto.Metric, now time.Time) metricdata.HistogramDataPoint[float64] {
+	dataPoint := metricdata.HistogramDataPoint[float64]{
+		Attributes: getAttributes(metric),
+		StartTime:  p.startTime,
+		Time:       now,
+		Count:      metric.GetHistogram().GetSampleCount(),
+		Sum:        metric.GetHistogram().GetSampleSum(),
+	}
+
+	previousCount := uint64(0)
+	for _, bucket := range metric.GetHistogram().GetBucket() {
+		// The last bucket (+Inf) is implied in OpenTelemetry
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			continue
+		}
+
+		dataPoint.Bounds = append(dataPoint.Bounds, bucket.GetUpperBound())
+		dataPoint.BucketCounts = append(dataPoint.BucketCounts, bucket.GetCumulativeCount()-previousCount)
+		previousCount = bucket.GetCumulativeCount()
+	}
+	dataPoint.BucketCounts = append(dataPoint.BucketCounts, dataPoint.Count-previousCount)
+
+	return dataPoint
+}
+
+// getAttributes return the labels of a metric as OpenTelemetry attributes
+func getAttributes(metric *dto.Metric) attribute.Set {
+	attributes := make([]attribute.KeyValue, 0, len(metric.GetLabel()))
+	for _, label := range metric.GetLabel() {
+		attributes = append(attributes, attribute.String(label.GetName(), label.GetValue()))
+	}
+
+	return attribute.NewSet(attributes...)
+}
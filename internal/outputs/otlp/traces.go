@@ -0,0 +1,340 @@
+package otlp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/kubernetes"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+const (
+	// tracesQueueSize is the amount of completed PipelineRuns waiting to be exported.
+	// When it is full, new ones are discarded, so watchers are never blocked
+	tracesQueueSize = 1000
+
+	// traceExportTimeout is the maximum time spent getting the TaskRuns of a PipelineRun
+	traceExportTimeout = 30 * time.Second
+
+	// traceIDContextKey is the key of the context value containing the trace ID of the spans being created
+	traceIDContextKey = "traceID"
+
+	// unknownValue is the value of the store for unknown pipelines, i.e. PipelineRuns with an embedded spec
+	unknownValue = "#"
+
+	exportingTracesMessage    = "Exporting completed PipelineRuns as traces to OTLP receiver %s (%s)"
+	tracesQueueFullMessage    = "traces queue is full. Discarding trace of PipelineRun %s/%s"
+	tracesDiscardedMessage    = "discarding %d queued traces on shutdown"
+	taskRunNotFoundMessage    = "TaskRun %s/%s of PipelineRun %s not found. Its span is not exported"
+	taskRunGetErrorMessage    = "impossible to get TaskRun %s/%s of PipelineRun %s: %w"
+	taskRunDecodeErrorMessage = "impossible to decode TaskRun %s/%s: %w"
+	unknownClusterMessage     = "unknown cluster '%s' of PipelineRun %s/%s. Its TaskRuns are not exported"
+)
+
+// TracesExporter exports completed PipelineRuns as traces to an OTLP receiver.
+// The PipelineRun is the root span, each of its TaskRuns is a child span, and each step of them is a grandchild.
+// The ID of each trace is the UID of its PipelineRun, so it can be found from the run
+type TracesExporter struct {
+	clients map[string]dynamic.Interface
+	queue   chan kubernetes.RunEvent
+
+	tracerProvider *sdktrace.TracerProvider
+	tracer         trace.Tracer
+}
+
+// NewTracesExporter return a new TracesExporter. Clusters are used to get the TaskRuns of the PipelineRuns
+func NewTracesExporter(ctx context.Context, clusters []kubernetes.Cluster,
+	otlpConfig config.OTLPOutputConfig) (tracesExporter *TracesExporter, err error) {
+
+	exporter, err := newTraceExporter(ctx, otlpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	exporterResource, err := NewResource(ctx, otlpConfig.ResourceAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(exporterResource),
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithIDGenerator(&runIDGenerator{}))
+
+	tracesExporter = &TracesExporter{
+		clients:        make(map[string]dynamic.Interface),
+		queue:          make(chan kubernetes.RunEvent, tracesQueueSize),
+		tracerProvider: tracerProvider,
+		tracer:         tracerProvider.Tracer(ServiceName),
+	}
+
+	for _, cluster := range clusters {
+		tracesExporter.clients[cluster.Name] = cluster.Client
+	}
+
+	globals.ExecContext.Logger.Infof(exportingTracesMessage, otlpConfig.Endpoint, otlpConfig.Protocol)
+	return tracesExporter, nil
+}
+
+// HandleRunEvent enqueue completed PipelineRuns to be exported.
+// It implements kubernetes.RunHandler interface
+func (e *TracesExporter) HandleRunEvent(ctx *context.Context, event kubernetes.RunEvent) {
+	if event.Transition != kubernetes.RunTransitionCompleted || event.StoreRun.Kind != tekton.PipelineRunKind {
+		return
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		globals.ExecContext.Logger.Warnf(tracesQueueFullMessage, event.StoreRun.Namespace, event.StoreRun.Name)
+	}
+}
+
+// Run export the queued PipelineRuns until the context is done. Then, spans already created are flushed
+// Hey!, this function is intended to be executed as a go routine
+func (e *TracesExporter) Run(ctx context.Context) error {
+	for {
+		select {
+		case event := <-e.queue:
+			exportCtx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+			e.exportPipelineRun(exportCtx, event)
+			cancel()
+
+		case <-ctx.Done():
+			if len(e.queue) > 0 {
+				globals.ExecContext.Logger.Warnf(tracesDiscardedMessage, len(e.queue))
+			}
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			defer cancel()
+
+			return e.tracerProvider.Shutdown(shutdownCtx)
+		}
+	}
+}
+
+// exportPipelineRun create the spans of a PipelineRun and its TaskRuns
+func (e *TracesExporter) exportPipelineRun(ctx context.Context, event kubernetes.RunEvent) {
+	pipelineRun := event.StoreRun
+
+	attributes := []attribute.KeyValue{
+		semconv.K8SNamespaceName(pipelineRun.Namespace),
+		attribute.String("tekton.pipelinerun.name", pipelineRun.Name),
+		attribute.String("tekton.pipelinerun.uid", pipelineRun.UID),
+	}
+
+	// The root span is named after the pipeline, or after the run when its pipeline is unknown
+	spanName := pipelineRun.Name
+	if pipelineRun.Pipeline != unknownValue {
+		spanName = pipelineRun.Pipeline
+		attributes = append(attributes, attribute.String("tekton.pipeline.name", pipelineRun.Pipeline))
+	}
+	if pipelineRun.Cluster != "" {
+		attributes = append(attributes, semconv.K8SClusterName(pipelineRun.Cluster))
+	}
+	for _, labelName := range config.Current().Labels.Populated {
+		if labelValue, found := pipelineRun.Labels[labelName]; found {
+			attributes = append(attributes, attribute.String("tekton.label."+labelName, labelValue))
+		}
+	}
+
+	startTime, completionTime := getSpanTimes(pipelineRun.StartTime, pipelineRun.CompletionTime)
+
+	ctx = context.WithValue(ctx, traceIDContextKey, getTraceID(pipelineRun.UID))
+	ctx, span := e.tracer.Start(ctx, spanName,
+		trace.WithTimestamp(startTime), trace.WithAttributes(attributes...))
+	setSpanStatus(span, pipelineRun.IsSucceeded(), pipelineRun.Status, pipelineRun.Reason)
+
+	for _, childReference := range event.Run.Status.ChildReferences {
+		if childReference.Kind != tekton.TaskRunKind {
+			continue
+		}
+
+		taskRun, err := e.getTaskRun(ctx, pipelineRun, childReference.Name)
+		if err != nil {
+			globals.ExecContext.Logger.Warn(err)
+			continue
+		}
+
+		e.exportTaskRun(ctx, pipelineRun, childReference, taskRun)
+	}
+
+	span.End(trace.WithTimestamp(completionTime))
+}
+
+// exportTaskRun create the span of a TaskRun and the spans of its steps
+func (e *TracesExporter) exportTaskRun(ctx context.Context, pipelineRun store.Run, childReference tekton.ChildReference,
+	taskRun *tekton.Run) {
+
+	var startTime, completionTime time.Time
+	if taskRun.Status.StartTime != nil {
+		startTime = taskRun.Status.StartTime.Time
+	}
+	if taskRun.Status.CompletionTime != nil {
+		completionTime = taskRun.Status.CompletionTime.Time
+	}
+
+	// Tasks still running when the PipelineRun completed (i.e. cancelled ones) end with it
+	if completionTime.IsZero() {
+		completionTime = pipelineRun.CompletionTime
+	}
+	startTime, completionTime = getSpanTimes(startTime, completionTime)
+
+	statusLabels := kubernetes.GetRunStatusPromLabels(taskRun)
+	ctx, span := e.tracer.Start(ctx, childReference.PipelineTaskName,
+		trace.WithTimestamp(startTime),
+		trace.WithAttributes(
+			semconv.K8SNamespaceName(taskRun.Metadata.Namespace),
+			attribute.String("tekton.taskrun.name", taskRun.Metadata.Name),
+			attribute.String("tekton.taskrun.uid", string(taskRun.Metadata.UID)),
+			attribute.String("tekton.task.name", taskRun.GetTaskName()),
+			attribute.Int("tekton.taskrun.retries", taskRun.GetRetries()),
+		))
+	setSpanStatus(span, taskRun.IsSucceeded(), statusLabels["status"], statusLabels["reason"])
+
+	for _, step := range taskRun.Status.Steps {
+		if step.Terminated == nil {
+			continue
+		}
+
+		_, stepSpan := e.tracer.Start(ctx, step.Name,
+			trace.WithTimestamp(step.Terminated.StartedAt.Time),
+			trace.WithAttributes(
+				attribute.String("tekton.step.name", step.Name),
+				attribute.String("tekton.step.container", step.Container),
+				attribute.Int("tekton.step.exit_code", int(step.Terminated.ExitCode)),
+				attribute.String("tekton.step.reason", step.Terminated.Reason),
+			))
+		if step.Terminated.ExitCode != 0 {
+			stepSpan.SetStatus(codes.Error, fmt.Sprintf("exit code %d", step.Terminated.ExitCode))
+		}
+		stepSpan.End(trace.WithTimestamp(step.Terminated.FinishedAt.Time))
+	}
+
+	span.End(trace.WithTimestamp(completionTime))
+}
+
+// getTaskRun return a TaskRun of a PipelineRun from the cluster the PipelineRun comes from
+func (e *TracesExporter) getTaskRun(ctx context.Context, pipelineRun store.Run, name string) (*tekton.Run, error) {
+	client, found := e.clients[pipelineRun.Cluster]
+	if !found {
+		return nil, fmt.Errorf(unknownClusterMessage, pipelineRun.Cluster, pipelineRun.Namespace, pipelineRun.Name)
+	}
+
+	taskRunKind, _ := kubernetes.GetRunKind(tekton.TaskRunKind)
+	object, err := client.Resource(taskRunKind.GVR()).Namespace(pipelineRun.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf(taskRunNotFoundMessage, pipelineRun.Namespace, name, pipelineRun.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(taskRunGetErrorMessage, pipelineRun.Namespace, name, pipelineRun.Name, err)
+	}
+
+	taskRun, err := tekton.NewRunFromUnstructured(tekton.TaskRunKind, object.Object)
+	if err != nil {
+		return nil, fmt.Errorf(taskRunDecodeErrorMessage, pipelineRun.Namespace, name, err)
+	}
+
+	return taskRun, nil
+}
+
+// newTraceExporter return an OTLP exporter for the protocol defined in the configuration
+func newTraceExporter(ctx context.Context, otlpConfig config.OTLPOutputConfig) (*otlptrace.Exporter, error) {
+
+	if otlpConfig.Protocol == config.OTLPProtocolHTTP {
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(otlpConfig.Endpoint)}
+		if otlpConfig.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		if len(otlpConfig.Headers) > 0 {
+			options = append(options, otlptracehttp.WithHeaders(otlpConfig.Headers))
+		}
+
+		return otlptracehttp.New(ctx, options...)
+	}
+
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(otlpConfig.Endpoint)}
+	if otlpConfig.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	if len(otlpConfig.Headers) > 0 {
+		options = append(options, otlptracegrpc.WithHeaders(otlpConfig.Headers))
+	}
+
+	return otlptracegrpc.New(ctx, options...)
+}
+
+// setSpanStatus set the status of a span from the outcome of its run
+func setSpanStatus(span trace.Span, succeeded bool, status, reason string) {
+	span.SetAttributes(attribute.String("tekton.run.status", status), attribute.String("tekton.run.reason", reason))
+
+	if !succeeded {
+		span.SetStatus(codes.Error, reason)
+		return
+	}
+	span.SetStatus(codes.Ok, "")
+}
+
+// getSpanTimes return the times of a span. Unknown start time (i.e. runs cancelled before starting)
+// is considered the completion time, and unknown completion time is considered now
+func getSpanTimes(startTime, completionTime time.Time) (time.Time, time.Time) {
+	if completionTime.IsZero() {
+		completionTime = time.Now()
+	}
+	if startTime.IsZero() {
+		startTime = completionTime
+	}
+	return startTime, completionTime
+}
+
+// getTraceID return the trace ID of a run from its UID.
+// UIDs are UUIDs, so they are used as they are. Otherwise, they are hashed
+func getTraceID(uid string) (traceID trace.TraceID) {
+	decodedUID, err := hex.DecodeString(strings.ReplaceAll(uid, "-", ""))
+	if err == nil && len(decodedUID) == len(traceID) {
+		copy(traceID[:], decodedUID)
+		return traceID
+	}
+
+	uidHash := sha256.Sum256([]byte(uid))
+	copy(traceID[:], uidHash[:])
+	return traceID
+}
+
+// runIDGenerator generates random span IDs, and trace IDs taken from the context when defined.
+// This way, the trace of a run has a known ID
+type runIDGenerator struct{}
+
+func (g *runIDGenerator) NewIDs(ctx context.Context) (traceID trace.TraceID, spanID trace.SpanID) {
+	traceID, found := ctx.Value(traceIDContextKey).(trace.TraceID)
+	if !found {
+		_, _ = rand.Read(traceID[:])
+	}
+	return traceID, g.NewSpanID(ctx, traceID)
+}
+
+func (g *runIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) (spanID trace.SpanID) {
+	_, _ = rand.Read(spanID[:])
+	return spanID
+}
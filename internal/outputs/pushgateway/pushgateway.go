@@ -0,0 +1,235 @@
+package pushgateway
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/metrics"
+)
+
+const (
+	// outputName identifies this output on exporter metrics
+	outputName = "pushgateway"
+
+	// pushAttempts is the amount of times a push is attempted before giving up until next interval.
+	// Attempts are spaced by an exponential backoff starting at retryInitialInterval
+	pushAttempts         = 3
+	retryInitialInterval = time.Second
+
+	// flushTimeout is the maximum time waited for the last push on shutdown
+	flushTimeout = 10 * time.Second
+
+	pushingMetricsMessage = "Pushing metrics to Pushgateway %s every %s"
+	pushErrorMessage      = "impossible to push metrics of group %s to Pushgateway: %v"
+	deleteErrorMessage    = "impossible to delete group %s from Pushgateway: %v"
+	gatherErrorMessage    = "impossible to gather metrics to push them to Pushgateway: %v"
+)
+
+var (
+	// groupingLabels are the labels of the metrics that are moved into the grouping key of their group
+	groupingLabels = []string{"cluster", "namespace"}
+)
+
+// group represents the metrics pushed under the same grouping key
+type group struct {
+	grouping       map[string]string
+	metricFamilies []*dto.MetricFamily
+}
+
+// Pusher pushes the metrics gathered from a Registry to a Pushgateway periodically.
+// Metrics are split in groups by their cluster and namespace, and each group replaces the previous one on each push.
+// This way, metrics of deleted runs are deleted from the Pushgateway, and groups without runs are deleted entirely
+type Pusher struct {
+	registry *metrics.Registry
+	config   config.PushgatewayOutputConfig
+
+	// pushedGroups are the grouping keys pushed last time, so the ones that are gone can be deleted
+	pushedGroups map[string]map[string]string
+}
+
+// NewPusher return a new Pusher of the metrics in a Registry
+func NewPusher(registry *metrics.Registry, pushgatewayConfig config.PushgatewayOutputConfig) *Pusher {
+	return &Pusher{
+		registry:     registry,
+		config:       pushgatewayConfig,
+		pushedGroups: make(map[string]map[string]string),
+	}
+}
+
+// Run push the metrics periodically until the context is done. Metrics are pushed one last time on shutdown
+// Hey!, this function is intended to be executed as a go routine
+func (p *Pusher) Run(ctx context.Context) {
+	globals.ExecContext.Logger.Infof(pushingMetricsMessage, p.config.URL, p.config.Interval)
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.pushGroups(ctx)
+
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			defer cancel()
+
+			p.pushGroups(flushCtx)
+			return
+		}
+	}
+}
+
+// pushGroups push each group of metrics, and delete the groups pushed before that are gone.
+// Nothing is pushed nor deleted while the Registry is disabled (i.e. on leader election followers),
+// so groups pushed by the leader are not altered
+func (p *Pusher) pushGroups(ctx context.Context) {
+	if !p.registry.IsEnabled() {
+		return
+	}
+
+	metricFamilies, err := p.registry.Gather()
+	if err != nil {
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Errorf(gatherErrorMessage, err)
+		return
+	}
+
+	groups := getGroups(metricFamilies)
+
+	for groupKey, currentGroup := range groups {
+		currentGroup := currentGroup
+		err := retry(ctx, func() error {
+			return p.newPusher(currentGroup.grouping).
+				Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+					return currentGroup.metricFamilies, nil
+				})).
+				PushContext(ctx)
+		})
+		if err != nil {
+			metrics.OutputErrors.WithLabelValues(outputName).Inc()
+			globals.ExecContext.Logger.Errorf(pushErrorMessage, groupKey, err)
+			continue
+		}
+
+		p.pushedGroups[groupKey] = currentGroup.grouping
+	}
+
+	// Groups whose runs have been deleted are deleted as well
+	for groupKey, grouping := range p.pushedGroups {
+		if _, found := groups[groupKey]; found {
+			continue
+		}
+
+		err := retry(ctx, p.newPusher(grouping).Delete)
+		if err != nil {
+			metrics.OutputErrors.WithLabelValues(outputName).Inc()
+			globals.ExecContext.Logger.Errorf(deleteErrorMessage, groupKey, err)
+			continue
+		}
+
+		delete(p.pushedGroups, groupKey)
+	}
+}
+
+// newPusher return a client for the group with a grouping key, including the static grouping labels
+func (p *Pusher) newPusher(grouping map[string]string) *push.Pusher {
+	pusher := push.New(p.config.URL, p.config.Job)
+
+	for labelName, labelValue := range p.config.Grouping {
+		pusher = pusher.Grouping(labelName, labelValue)
+	}
+
+	for labelName, labelValue := range grouping {
+		pusher = pusher.Grouping(labelName, labelValue)
+	}
+
+	return pusher
+}
+
+// getGroups split the metric families into groups by the values of their grouping labels.
+// Grouping labels are removed from the metrics, as Pushgateway adds them from the grouping key
+func getGroups(metricFamilies []*dto.MetricFamily) (groups map[string]*group) {
+	groups = make(map[string]*group)
+
+	for _, metricFamily := range metricFamilies {
+		groupFamilies := make(map[string]*dto.MetricFamily)
+
+		for _, metric := range metricFamily.GetMetric() {
+			grouping, groupMetric := splitGroupingLabels(metric)
+			groupKey := getGroupKey(grouping)
+
+			if _, found := groups[groupKey]; !found {
+				groups[groupKey] = &group{grouping: grouping}
+			}
+
+			groupFamily, found := groupFamilies[groupKey]
+			if !found {
+				groupFamily = &dto.MetricFamily{Name: metricFamily.Name, Help: metricFamily.Help, Type: metricFamily.Type}
+				groupFamilies[groupKey] = groupFamily
+				groups[groupKey].metricFamilies = append(groups[groupKey].metricFamilies, groupFamily)
+			}
+			groupFamily.Metric = append(groupFamily.Metric, groupMetric)
+		}
+	}
+
+	return groups
+}
+
+// splitGroupingLabels return the values of the grouping labels of a metric, and a copy of it without them
+func splitGroupingLabels(metric *dto.Metric) (grouping map[string]string, groupMetric *dto.Metric) {
+	grouping = make(map[string]string)
+	groupMetric = proto.Clone(metric).(*dto.Metric)
+	groupMetric.Label = nil
+
+	for _, label := range metric.GetLabel() {
+		if slices.Contains(groupingLabels, label.GetName()) {
+			grouping[label.GetName()] = label.GetValue()
+			continue
+		}
+		groupMetric.Label = append(groupMetric.Label, label)
+	}
+
+	return grouping, groupMetric
+}
+
+// getGroupKey return a string that identifies a grouping key
+func getGroupKey(grouping map[string]string) string {
+	pairs := make([]string, 0, len(grouping))
+	for labelName, labelValue := range grouping {
+		pairs = append(pairs, labelName+"="+labelValue)
+	}
+	sort.Strings(pairs)
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// retry execute an action until it succeeds, backing off between attempts.
+// It gives up after pushAttempts attempts or when the context is done, returning the last error
+func retry(ctx context.Context, action func() error) (err error) {
+	interval := retryInitialInterval
+
+	for attempt := 1; ; attempt++ {
+		err = action()
+		if err == nil || attempt == pushAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+			interval *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
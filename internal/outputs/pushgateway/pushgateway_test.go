@@ -0,0 +1,238 @@
+package pushgateway
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+// pushRequest represents a request received by the fake Pushgateway, with its grouping key decoded from the path
+type pushRequest struct {
+	method   string
+	grouping map[string]string
+	body     string
+}
+
+// fakePushgateway keeps the requests it receives, answering them with the given status code
+type fakePushgateway struct {
+	t          *testing.T
+	statusCode int
+
+	mutex    sync.Mutex
+	requests []pushRequest
+}
+
+func (g *fakePushgateway) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	body, _ := io.ReadAll(request.Body)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.requests = append(g.requests, pushRequest{
+		method:   request.Method,
+		grouping: parseGroupingPath(g.t, request.URL.EscapedPath()),
+		body:     string(body),
+	})
+	writer.WriteHeader(g.statusCode)
+}
+
+// getRequests return the requests received with a method
+func (g *fakePushgateway) getRequests(method string) (requests []pushRequest) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, request := range g.requests {
+		if request.method == method {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// parseGroupingPath decode a path like '/metrics/job/<job>/<label>/<value>...' into the labels of its grouping key.
+// Values with '/' are encoded in base64, with the '@base64' suffix in the label name
+func parseGroupingPath(t *testing.T, path string) map[string]string {
+	components := strings.Split(strings.TrimPrefix(path, "/metrics/"), "/")
+	if len(components)%2 != 0 {
+		t.Errorf("unexpected grouping path: %s", path)
+		return nil
+	}
+
+	grouping := make(map[string]string)
+	for index := 0; index < len(components); index += 2 {
+		labelName, labelValue := components[index], components[index+1]
+
+		if name, found := strings.CutSuffix(labelName, "@base64"); found {
+			value, err := base64.RawURLEncoding.DecodeString(labelValue)
+			if err != nil {
+				t.Errorf("unexpected base64 value in path %s: %v", path, err)
+			}
+			labelName, labelValue = name, string(value)
+		}
+		grouping[labelName] = labelValue
+	}
+	return grouping
+}
+
+// newTestPusher return a Pusher of a Registry with a completed PipelineRun in each namespace, and its collector
+func newTestPusher(t *testing.T, url string, namespaces ...string) (*Pusher, *metrics.Collector) {
+	collector := metrics.NewCollector(store.NewStore(0), metrics.CollectorOptions{
+		LabelsPlacement:     config.LabelsPlacementInfo,
+		FlakinessWindowSize: 10,
+		RunKinds:            []metrics.RunKindMetrics{{Kind: tekton.PipelineRunKind}},
+		ClusterLabel:        true,
+	})
+
+	for _, namespace := range namespaces {
+		collector.UpdateRun(newTestRun(namespace))
+	}
+
+	registry, err := metrics.NewRegistry(collector)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pusher := NewPusher(registry, config.PushgatewayOutputConfig{
+		URL:      url,
+		Job:      "tekton-exporter",
+		Interval: time.Hour,
+		Grouping: map[string]string{"env": "prod/eu"},
+	})
+	return pusher, collector
+}
+
+// newTestRun return a completed PipelineRun in a namespace
+func newTestRun(namespace string) store.Run {
+	startTime := time.Date(2024, 5, 2, 10, 15, 0, 0, time.UTC)
+	return store.Run{
+		Cluster:        "east",
+		Kind:           tekton.PipelineRunKind,
+		Namespace:      namespace,
+		Name:           "build-x7k2p",
+		UID:            namespace + "-3f6c1a2e",
+		Pipeline:       "build",
+		Task:           "#",
+		Status:         "success",
+		Reason:         "Succeeded",
+		StartTime:      startTime,
+		CompletionTime: startTime.Add(90 * time.Second),
+	}
+}
+
+func TestPushGroupsByClusterAndNamespace(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	gateway := &fakePushgateway{t: t, statusCode: http.StatusOK}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	pusher, _ := newTestPusher(t, server.URL, "ci", "cd")
+	pusher.pushGroups(context.Background())
+
+	requests := gateway.getRequests(http.MethodPut)
+	if len(requests) != 2 {
+		t.Fatalf("expected a group per namespace, got %d requests", len(requests))
+	}
+
+	pushedNamespaces := make(map[string]bool)
+	for _, request := range requests {
+		grouping := request.grouping
+
+		// Static grouping labels with '/' are encoded in base64 by the client, and decoded back here
+		if grouping["job"] != "tekton-exporter" || grouping["env"] != "prod/eu" || grouping["cluster"] != "east" ||
+			len(grouping) != 4 {
+			t.Errorf("unexpected grouping key: %v", grouping)
+		}
+		pushedNamespaces[grouping["namespace"]] = true
+
+		if !strings.Contains(request.body, "tekton_exporter_pipelinerun_status") {
+			t.Errorf("expected the metrics of the runs to be pushed in group %v", grouping)
+		}
+
+		// Grouping labels are removed from the metrics, as the Pushgateway adds them from the grouping key
+		if strings.Contains(request.body, "namespace") || strings.Contains(request.body, "east") {
+			t.Errorf("expected grouping labels to be removed from the metrics of group %v", grouping)
+		}
+	}
+
+	if !pushedNamespaces["ci"] || !pushedNamespaces["cd"] {
+		t.Errorf("expected groups of namespaces ci and cd, got %v", pushedNamespaces)
+	}
+}
+
+func TestPushGroupsDeletesVanishedGroups(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	gateway := &fakePushgateway{t: t, statusCode: http.StatusAccepted}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	pusher, collector := newTestPusher(t, server.URL, "ci", "cd")
+	pusher.pushGroups(context.Background())
+
+	if deletes := gateway.getRequests(http.MethodDelete); len(deletes) != 0 {
+		t.Fatalf("expected no group to be deleted, got %v", deletes)
+	}
+
+	// The only run of namespace cd is deleted, so its group is gone on next push
+	collector.DeleteRun(newTestRun("cd"))
+	pusher.pushGroups(context.Background())
+
+	deletes := gateway.getRequests(http.MethodDelete)
+	if len(deletes) != 1 || deletes[0].grouping["namespace"] != "cd" || deletes[0].grouping["env"] != "prod/eu" {
+		t.Fatalf("expected the group of namespace cd to be deleted, got %v", deletes)
+	}
+
+	if len(gateway.getRequests(http.MethodPut)) != 3 {
+		t.Errorf("expected the group of namespace ci to be pushed again")
+	}
+
+	// Deleted groups are forgotten, so they are not deleted again
+	pusher.pushGroups(context.Background())
+	if deletes = gateway.getRequests(http.MethodDelete); len(deletes) != 1 {
+		t.Errorf("expected the group to be deleted once, got %d deletes", len(deletes))
+	}
+}
+
+func TestPushGroupsAccountsErrors(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	gateway := &fakePushgateway{t: t, statusCode: http.StatusServiceUnavailable}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	pusher, _ := newTestPusher(t, server.URL, "ci")
+	previousErrors := testutil.ToFloat64(metrics.OutputErrors.WithLabelValues(outputName))
+
+	pusher.pushGroups(context.Background())
+
+	if requests := gateway.getRequests(http.MethodPut); len(requests) != pushAttempts {
+		t.Errorf("expected the push to be attempted %d times, got %d", pushAttempts, len(requests))
+	}
+
+	accountedErrors := testutil.ToFloat64(metrics.OutputErrors.WithLabelValues(outputName)) - previousErrors
+	if accountedErrors != 1 {
+		t.Errorf("expected a single error to be accounted, got %v", accountedErrors)
+	}
+
+	// Groups that were not pushed are not remembered, so they are never deleted
+	if len(pusher.pushedGroups) != 0 {
+		t.Errorf("expected no pushed groups, got %v", pusher.pushedGroups)
+	}
+}
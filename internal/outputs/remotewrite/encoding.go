@@ -0,0 +1,201 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Following are the field numbers of the messages of remote-write v1 protocol
+// Ref: https://github.com/prometheus/prometheus/blob/main/prompb/remote.proto
+const (
+	writeRequestTimeseriesField = 1
+	writeRequestMetadataField   = 3
+
+	timeSeriesLabelsField  = 1
+	timeSeriesSamplesField = 2
+
+	labelNameField  = 1
+	labelValueField = 2
+
+	sampleValueField     = 1
+	sampleTimestampField = 2
+
+	metadataTypeField = 1
+	metadataNameField = 2
+	metadataHelpField = 4
+)
+
+// Following are the metric types of remote-write v1 metadata
+var metadataTypes = map[dto.MetricType]uint64{
+	dto.MetricType_UNTYPED:   0,
+	dto.MetricType_COUNTER:   1,
+	dto.MetricType_GAUGE:     2,
+	dto.MetricType_HISTOGRAM: 3,
+	dto.MetricType_SUMMARY:   5,
+}
+
+// Label represents a label of a time series
+type Label struct {
+	Name  string
+	Value string
+}
+
+// TimeSeries represents a sample of a series, identified by its labels (including '__name__')
+type TimeSeries struct {
+	Labels    []Label
+	Value     float64
+	Timestamp int64
+}
+
+// Metadata represents the type and help of a metric family
+type Metadata struct {
+	Type dto.MetricType
+	Name string
+	Help string
+}
+
+// getTimeSeries convert metric families into time series, as Prometheus does when scraping them:
+// histograms and summaries are split into '_bucket' or quantiles, '_sum' and '_count' series.
+// External labels are added to all of them, without overriding the labels of the metrics
+func getTimeSeries(metricFamilies []*dto.MetricFamily, externalLabels map[string]string,
+	timestamp int64) (timeSeries []TimeSeries, metadata []Metadata) {
+
+	for _, metricFamily := range metricFamilies {
+		name := metricFamily.GetName()
+		metadata = append(metadata, Metadata{Type: metricFamily.GetType(), Name: name, Help: metricFamily.GetHelp()})
+
+		for _, metric := range metricFamily.GetMetric() {
+			newSeries := func(seriesName string, value float64, extraLabels ...Label) {
+				timeSeries = append(timeSeries, TimeSeries{
+					Labels:    getLabels(seriesName, metric, externalLabels, extraLabels),
+					Value:     value,
+					Timestamp: timestamp,
+				})
+			}
+
+			switch metricFamily.GetType() {
+			case dto.MetricType_COUNTER:
+				newSeries(name, metric.GetCounter().GetValue())
+
+			case dto.MetricType_GAUGE:
+				newSeries(name, metric.GetGauge().GetValue())
+
+			case dto.MetricType_UNTYPED:
+				newSeries(name, metric.GetUntyped().GetValue())
+
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.GetBucket() {
+					// '+Inf' bucket is always added from the sample count, as it is not always explicit
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						continue
+					}
+					newSeries(name+"_bucket", float64(bucket.GetCumulativeCount()),
+						Label{Name: "le", Value: formatFloat(bucket.GetUpperBound())})
+				}
+				newSeries(name+"_bucket", float64(histogram.GetSampleCount()), Label{Name: "le", Value: "+Inf"})
+				newSeries(name+"_sum", histogram.GetSampleSum())
+				newSeries(name+"_count", float64(histogram.GetSampleCount()))
+
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					newSeries(name, quantile.GetValue(), Label{Name: "quantile", Value: formatFloat(quantile.GetQuantile())})
+				}
+				newSeries(name+"_sum", summary.GetSampleSum())
+				newSeries(name+"_count", float64(summary.GetSampleCount()))
+			}
+		}
+	}
+
+	return timeSeries, metadata
+}
+
+// getLabels return the labels of a series sorted by name, as remote-write receivers require
+func getLabels(name string, metric *dto.Metric, externalLabels map[string]string, extraLabels []Label) []Label {
+	labels := make([]Label, 0, len(metric.GetLabel())+len(externalLabels)+len(extraLabels)+1)
+	labels = append(labels, Label{Name: "__name__", Value: name})
+
+	metricLabelNames := make(map[string]bool, len(metric.GetLabel()))
+	for _, label := range metric.GetLabel() {
+		metricLabelNames[label.GetName()] = true
+		labels = append(labels, Label{Name: label.GetName(), Value: label.GetValue()})
+	}
+	labels = append(labels, extraLabels...)
+
+	for labelName, labelValue := range externalLabels {
+		if !metricLabelNames[labelName] {
+			labels = append(labels, Label{Name: labelName, Value: labelValue})
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+
+	return labels
+}
+
+// formatFloat format a float as Prometheus does in 'le' and 'quantile' labels
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// encodeWriteRequest encode time series and metadata as a remote-write v1 WriteRequest protobuf message
+func encodeWriteRequest(timeSeries []TimeSeries, metadata []Metadata) (message []byte) {
+	for _, series := range timeSeries {
+		message = protowire.AppendTag(message, writeRequestTimeseriesField, protowire.BytesType)
+		message = protowire.AppendBytes(message, encodeTimeSeries(series))
+	}
+
+	for _, familyMetadata := range metadata {
+		message = protowire.AppendTag(message, writeRequestMetadataField, protowire.BytesType)
+		message = protowire.AppendBytes(message, encodeMetadata(familyMetadata))
+	}
+
+	return message
+}
+
+// encodeTimeSeries encode a TimeSeries protobuf message with a single sample
+func encodeTimeSeries(series TimeSeries) (message []byte) {
+	for _, label := range series.Labels {
+		var labelMessage []byte
+		labelMessage = protowire.AppendTag(labelMessage, labelNameField, protowire.BytesType)
+		labelMessage = protowire.AppendString(labelMessage, label.Name)
+		labelMessage = protowire.AppendTag(labelMessage, labelValueField, protowire.BytesType)
+		labelMessage = protowire.AppendString(labelMessage, label.Value)
+
+		message = protowire.AppendTag(message, timeSeriesLabelsField, protowire.BytesType)
+		message = protowire.AppendBytes(message, labelMessage)
+	}
+
+	var sampleMessage []byte
+	sampleMessage = protowire.AppendTag(sampleMessage, sampleValueField, protowire.Fixed64Type)
+	sampleMessage = protowire.AppendFixed64(sampleMessage, math.Float64bits(series.Value))
+	sampleMessage = protowire.AppendTag(sampleMessage, sampleTimestampField, protowire.VarintType)
+	sampleMessage = protowire.AppendVarint(sampleMessage, uint64(series.Timestamp))
+
+	message = protowire.AppendTag(message, timeSeriesSamplesField, protowire.BytesType)
+	message = protowire.AppendBytes(message, sampleMessage)
+
+	return message
+}
+
+// encodeMetadata encode a MetricMetadata protobuf message
+func encodeMetadata(metadata Metadata) (message []byte) {
+	message = protowire.AppendTag(message, metadataTypeField, protowire.VarintType)
+	message = protowire.AppendVarint(message, metadataTypes[metadata.Type])
+	message = protowire.AppendTag(message, metadataNameField, protowire.BytesType)
+	message = protowire.AppendString(message, metadata.Name)
+	message = protowire.AppendTag(message, metadataHelpField, protowire.BytesType)
+	message = protowire.AppendString(message, metadata.Help)
+
+	return message
+}
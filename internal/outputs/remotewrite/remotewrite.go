@@ -0,0 +1,277 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/metrics"
+)
+
+const (
+	// outputName identifies this output on exporter metrics
+	outputName = "remote_write"
+
+	// flushTimeout is the maximum time waited for queued samples to be sent on shutdown
+	flushTimeout = 10 * time.Second
+
+	// requestTimeout is the maximum time waited for each request to the receiver
+	requestTimeout = 30 * time.Second
+
+	userAgent             = "tekton-exporter"
+	remoteWriteVersion    = "0.1.0"
+	maxErrorBodyLength    = 256
+	writingMetricsMessage = "Writing metrics to remote-write receiver %s every %s with %d shards"
+	gatherErrorMessage    = "impossible to gather metrics to write them to remote-write receiver: %v"
+	queueFullMessage      = "remote-write queue is full. %d samples have been discarded"
+	sendErrorMessage      = "impossible to write %d samples to remote-write receiver: %v"
+	sendRetryMessage      = "impossible to write %d samples to remote-write receiver. Retrying in %s: %v"
+	metadataErrorMessage  = "impossible to write metadata to remote-write receiver: %v"
+)
+
+// Writer writes the metrics gathered from a Registry to a remote-write v1 receiver periodically.
+// Samples are queued in memory, split in shards by series, so the samples of a series are always sent in order.
+// Failed requests are retried with exponential backoff while they are recoverable (i.e. 5xx or 429 responses)
+type Writer struct {
+	registry *metrics.Registry
+	config   config.RemoteWriteOutputConfig
+	client   *http.Client
+
+	shards []chan TimeSeries
+}
+
+// recoverableError represents a failed request that can succeed if it is retried
+type recoverableError struct {
+	error
+}
+
+// NewWriter return a new Writer of the metrics in a Registry
+func NewWriter(registry *metrics.Registry, remoteWriteConfig config.RemoteWriteOutputConfig) *Writer {
+	writer := &Writer{
+		registry: registry,
+		config:   remoteWriteConfig,
+		client:   &http.Client{Timeout: requestTimeout},
+		shards:   make([]chan TimeSeries, remoteWriteConfig.Queue.Shards),
+	}
+
+	for index := range writer.shards {
+		writer.shards[index] = make(chan TimeSeries, remoteWriteConfig.Queue.Capacity)
+	}
+
+	return writer
+}
+
+// Run sample the metrics periodically until the context is done, sending them from the shards.
+// On shutdown, metrics are sampled one last time, and queued samples are sent within a bounded period
+// Hey!, this function is intended to be executed as a go routine
+func (w *Writer) Run(ctx context.Context) {
+	globals.ExecContext.Logger.Infof(writingMetricsMessage, w.config.URL, w.config.Interval, len(w.shards))
+
+	// Shards are not stopped by the context, so they can send the queued samples on shutdown
+	sendCtx, cancelSend := context.WithCancel(context.Background())
+	defer cancelSend()
+
+	var shardsWaitGroup sync.WaitGroup
+	for _, shard := range w.shards {
+		shard := shard
+		shardsWaitGroup.Add(1)
+		go func() {
+			defer shardsWaitGroup.Done()
+			w.runShard(sendCtx, shard)
+		}()
+	}
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.sample(sendCtx)
+
+		case <-ctx.Done():
+			w.sample(sendCtx)
+			for _, shard := range w.shards {
+				close(shard)
+			}
+
+			shardsDone := make(chan struct{})
+			go func() {
+				shardsWaitGroup.Wait()
+				close(shardsDone)
+			}()
+
+			// Requests in progress are cancelled once the timeout is reached
+			select {
+			case <-shardsDone:
+			case <-time.After(flushTimeout):
+				cancelSend()
+				<-shardsDone
+			}
+			return
+		}
+	}
+}
+
+// sample gather the metrics and queue their samples into the shards.
+// Nothing is sampled while the Registry is disabled (i.e. on leader election followers)
+func (w *Writer) sample(ctx context.Context) {
+	if !w.registry.IsEnabled() {
+		return
+	}
+
+	metricFamilies, err := w.registry.Gather()
+	if err != nil {
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Errorf(gatherErrorMessage, err)
+		return
+	}
+
+	timeSeries, metadata := getTimeSeries(metricFamilies, w.config.ExternalLabels, time.Now().UnixMilli())
+
+	discardedSamples := 0
+	for _, series := range timeSeries {
+		select {
+		case w.shards[getShardIndex(series.Labels, len(w.shards))] <- series:
+		default:
+			discardedSamples++
+		}
+	}
+
+	if discardedSamples > 0 {
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Warnf(queueFullMessage, discardedSamples)
+	}
+
+	// Metadata is not critical, so it is sent once without retrying
+	if len(metadata) == 0 {
+		return
+	}
+
+	err = w.write(ctx, encodeWriteRequest(nil, metadata))
+	if err != nil {
+		globals.ExecContext.Logger.Warnf(metadataErrorMessage, err)
+	}
+}
+
+// runShard send the samples queued in a shard in batches, until the shard is closed.
+// Batches are sent when they are full, or when the oldest sample has waited for the batch send deadline
+func (w *Writer) runShard(ctx context.Context, shard <-chan TimeSeries) {
+	batch := make([]TimeSeries, 0, w.config.Queue.MaxSamplesPerSend)
+
+	deadline := time.NewTimer(w.config.Queue.BatchSendDeadline)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case series, open := <-shard:
+			if !open {
+				w.sendBatch(ctx, batch)
+				return
+			}
+
+			batch = append(batch, series)
+			if len(batch) >= w.config.Queue.MaxSamplesPerSend {
+				w.sendBatch(ctx, batch)
+				batch = batch[:0]
+			}
+
+		case <-deadline.C:
+			w.sendBatch(ctx, batch)
+			batch = batch[:0]
+			deadline.Reset(w.config.Queue.BatchSendDeadline)
+		}
+	}
+}
+
+// sendBatch write a batch of samples, retrying with exponential backoff while the failure is recoverable
+func (w *Writer) sendBatch(ctx context.Context, batch []TimeSeries) {
+	if len(batch) == 0 {
+		return
+	}
+
+	request := encodeWriteRequest(batch, nil)
+	backoff := w.config.Queue.MinBackoff
+
+	for {
+		err := w.write(ctx, request)
+		if err == nil {
+			return
+		}
+
+		_, recoverable := err.(recoverableError)
+		if !recoverable || ctx.Err() != nil {
+			metrics.OutputErrors.WithLabelValues(outputName).Inc()
+			globals.ExecContext.Logger.Errorf(sendErrorMessage, len(batch), err)
+			return
+		}
+
+		globals.ExecContext.Logger.Debugf(sendRetryMessage, len(batch), backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+
+		backoff = min(backoff*2, w.config.Queue.MaxBackoff)
+	}
+}
+
+// write send an encoded WriteRequest to the receiver, compressed with snappy.
+// Network errors, 5xx and 429 responses are recoverable
+func (w *Writer) write(ctx context.Context, writeRequest []byte) error {
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL,
+		bytes.NewReader(snappy.Encode(nil, writeRequest)))
+	if err != nil {
+		return err
+	}
+
+	httpRequest.Header.Set("Content-Encoding", "snappy")
+	httpRequest.Header.Set("Content-Type", "application/x-protobuf")
+	httpRequest.Header.Set("User-Agent", userAgent)
+	httpRequest.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	for headerName, headerValue := range w.config.Headers {
+		httpRequest.Header.Set(headerName, headerValue)
+	}
+
+	response, err := w.client.Do(httpRequest)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodyLength))
+	err = fmt.Errorf("unexpected status code %d: %s", response.StatusCode, bytes.TrimSpace(body))
+	if response.StatusCode/100 == 5 || response.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+
+	return err
+}
+
+// getShardIndex return the shard of a series from the hash of its labels
+func getShardIndex(labels []Label, shardsCount int) int {
+	hash := fnv.New64a()
+	for _, label := range labels {
+		_, _ = hash.Write([]byte(label.Name))
+		_, _ = hash.Write([]byte{0xff})
+		_, _ = hash.Write([]byte(label.Value))
+		_, _ = hash.Write([]byte{0xff})
+	}
+
+	return int(hash.Sum64() % uint64(shardsCount))
+}
@@ -0,0 +1,278 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+// decodedWriteRequest represents a remote-write v1 WriteRequest, decoded independently of the encoder.
+// Each series is decoded with its labels and samples
+// Ref: https://github.com/prometheus/prometheus/blob/main/prompb/remote.proto
+type decodedWriteRequest struct {
+	timeSeries []decodedTimeSeries
+	metadata   []string
+}
+
+type decodedTimeSeries struct {
+	labels  map[string]string
+	samples []float64
+}
+
+// protoField represents a field of a protobuf message: the content of length-delimited ones, or the value of others
+type protoField struct {
+	number  protowire.Number
+	content []byte
+	value   uint64
+}
+
+// parseFields split a protobuf message into its fields
+func parseFields(message []byte) (fields []protoField, err error) {
+	for len(message) > 0 {
+		number, fieldType, length := protowire.ConsumeTag(message)
+		if length < 0 {
+			return nil, protowire.ParseError(length)
+		}
+		message = message[length:]
+
+		field := protoField{number: number}
+		switch fieldType {
+		case protowire.BytesType:
+			field.content, length = protowire.ConsumeBytes(message)
+		case protowire.VarintType:
+			field.value, length = protowire.ConsumeVarint(message)
+		case protowire.Fixed64Type:
+			field.value, length = protowire.ConsumeFixed64(message)
+		default:
+			return nil, errors.New("unexpected wire type")
+		}
+		if length < 0 {
+			return nil, protowire.ParseError(length)
+		}
+		message = message[length:]
+
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// decodeWriteRequest decode a WriteRequest message: timeseries are field 1 and metadata field 3.
+// Series have labels (field 1, with name 1 and value 2) and samples (field 2, with a double value 1 and timestamp 2)
+func decodeWriteRequest(message []byte) (writeRequest *decodedWriteRequest, err error) {
+	requestFields, err := parseFields(message)
+	if err != nil {
+		return nil, err
+	}
+
+	writeRequest = &decodedWriteRequest{}
+	for _, requestField := range requestFields {
+		switch requestField.number {
+		case 1:
+			series := decodedTimeSeries{labels: make(map[string]string)}
+
+			seriesFields, err := parseFields(requestField.content)
+			if err != nil {
+				return nil, err
+			}
+			for _, seriesField := range seriesFields {
+				fields, err := parseFields(seriesField.content)
+				if err != nil || len(fields) != 2 {
+					return nil, errors.New("malformed label or sample")
+				}
+
+				switch seriesField.number {
+				case 1:
+					series.labels[string(fields[0].content)] = string(fields[1].content)
+				case 2:
+					series.samples = append(series.samples, math.Float64frombits(fields[0].value))
+				}
+			}
+			writeRequest.timeSeries = append(writeRequest.timeSeries, series)
+
+		case 3:
+			metadataFields, err := parseFields(requestField.content)
+			if err != nil {
+				return nil, err
+			}
+			for _, metadataField := range metadataFields {
+				if metadataField.number == 2 {
+					writeRequest.metadata = append(writeRequest.metadata, string(metadataField.content))
+				}
+			}
+		}
+	}
+	return writeRequest, nil
+}
+
+// writeReceiver is a remote-write receiver that decodes the requests it receives,
+// answering requests with samples with the given status codes in order (the last one is repeated)
+type writeReceiver struct {
+	t           *testing.T
+	statusCodes []int
+
+	mutex           sync.Mutex
+	samplesRequests []*decodedWriteRequest
+}
+
+func (r *writeReceiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Header.Get("Content-Encoding") != "snappy" || request.Header.Get("Content-Type") != "application/x-protobuf" ||
+		request.Header.Get("X-Prometheus-Remote-Write-Version") != remoteWriteVersion {
+		r.t.Errorf("unexpected headers: %v", request.Header)
+	}
+
+	compressed, err := io.ReadAll(request.Body)
+	if err != nil {
+		r.t.Errorf("impossible to read request: %v", err)
+		return
+	}
+
+	content, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		r.t.Errorf("impossible to decompress request: %v", err)
+		return
+	}
+
+	writeRequest, err := decodeWriteRequest(content)
+	if err != nil {
+		r.t.Errorf("impossible to decode request: %v", err)
+		return
+	}
+
+	// Requests with metadata only are always accepted
+	if len(writeRequest.timeSeries) == 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	statusCode := r.statusCodes[min(len(r.samplesRequests), len(r.statusCodes)-1)]
+	r.samplesRequests = append(r.samplesRequests, writeRequest)
+	writer.WriteHeader(statusCode)
+}
+
+// newTestRegistry return a Registry whose metrics are rendered from a completed PipelineRun
+func newTestRegistry(t *testing.T) *metrics.Registry {
+	collector := metrics.NewCollector(store.NewStore(0), metrics.CollectorOptions{
+		LabelsPlacement:     config.LabelsPlacementInfo,
+		FlakinessWindowSize: 10,
+		RunKinds:            []metrics.RunKindMetrics{{Kind: tekton.PipelineRunKind}},
+	})
+
+	startTime := time.Date(2024, 5, 2, 10, 15, 0, 0, time.UTC)
+	collector.UpdateRun(store.Run{
+		Kind:           tekton.PipelineRunKind,
+		Namespace:      "ci",
+		Name:           "build-x7k2p",
+		UID:            "3f6c1a2e",
+		Pipeline:       "build",
+		Task:           "#",
+		Status:         "success",
+		Reason:         "Succeeded",
+		StartTime:      startTime,
+		CompletionTime: startTime.Add(90 * time.Second),
+	})
+
+	registry, err := metrics.NewRegistry(collector)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return registry
+}
+
+// writeOnce run a Writer until the samples taken on shutdown are sent
+func writeOnce(t *testing.T, url string) {
+	writer := NewWriter(newTestRegistry(t), config.RemoteWriteOutputConfig{
+		URL:            url,
+		Interval:       time.Hour,
+		ExternalLabels: map[string]string{"cluster": "east", "namespace": "external"},
+		Queue: config.RemoteWriteQueueConfig{
+			Shards:            1,
+			Capacity:          100,
+			MaxSamplesPerSend: 100,
+			BatchSendDeadline: time.Hour,
+			MinBackoff:        10 * time.Millisecond,
+			MaxBackoff:        50 * time.Millisecond,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer.Run(ctx)
+}
+
+// getSeries return the labels and the value of a series, by its metric name
+func getSeries(writeRequest *decodedWriteRequest, name string) (labels map[string]string, value float64, found bool) {
+	for _, series := range writeRequest.timeSeries {
+		if series.labels["__name__"] == name && len(series.samples) == 1 {
+			return series.labels, series.samples[0], true
+		}
+	}
+	return nil, 0, false
+}
+
+func TestWriterRetriesServerErrors(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	receiver := &writeReceiver{t: t, statusCodes: []int{http.StatusServiceUnavailable, http.StatusNoContent}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	writeOnce(t, server.URL)
+
+	if len(receiver.samplesRequests) != 2 {
+		t.Fatalf("expected the failed request to be retried once, got %d requests", len(receiver.samplesRequests))
+	}
+
+	// Retries send the same samples
+	for _, writeRequest := range receiver.samplesRequests {
+		labels, value, found := getSeries(writeRequest, "tekton_exporter_pipelinerun_duration_seconds")
+		if !found {
+			t.Fatalf("expected duration series, got %v", writeRequest.timeSeries)
+		}
+
+		if value != 90 {
+			t.Errorf("expected a duration of 90 seconds, got %v", value)
+		}
+
+		// External labels are added, unless the series already has a label with the same name
+		if labels["cluster"] != "east" || labels["namespace"] != "ci" || labels["name"] != "build-x7k2p" {
+			t.Errorf("unexpected labels: %v", labels)
+		}
+
+		if _, value, found = getSeries(writeRequest, "tekton_exporter_pipelinerun_status"); !found || value != 1 {
+			t.Errorf("expected a status of 1, got %v (found: %t)", value, found)
+		}
+	}
+}
+
+func TestWriterDoesNotRetryClientErrors(t *testing.T) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	receiver := &writeReceiver{t: t, statusCodes: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	writeOnce(t, server.URL)
+
+	if len(receiver.samplesRequests) != 1 {
+		t.Fatalf("expected the failed request not to be retried, got %d requests", len(receiver.samplesRequests))
+	}
+}
@@ -0,0 +1,243 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/kubernetes"
+	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+const (
+	// outputName identifies this output on exporter metrics
+	outputName = "statsd"
+
+	// eventsQueueSize is the amount of completed runs waiting to be emitted.
+	// When it is full, new ones are discarded, so watchers are never blocked
+	eventsQueueSize = 1000
+
+	// Following are the types of the metrics in StatsD protocol
+	metricTypeCounter      = "c"
+	metricTypeGauge        = "g"
+	metricTypeTimer        = "ms"
+	metricTypeDistribution = "d"
+
+	emittingMetricsMessage = "Emitting metrics of completed runs to %s server %s"
+	queueFullMessage       = "statsd queue is full. Discarding metrics of %s %s/%s"
+	sendErrorMessage       = "impossible to send metrics to statsd server: %v"
+)
+
+var (
+	// nameReplacer and tagReplacer replace the characters reserved by the protocol in metric names and tags
+	nameReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_")
+	tagReplacer  = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+
+	// segmentReplacer replace the characters that can not be part of a segment of a metric name in plain StatsD,
+	// including dots, as they separate the segments
+	segmentReplacer = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", "/", "_", " ", "_", "\n", "_")
+)
+
+// unknownValue is the value of the store for unknown pipelines and tasks
+const unknownValue = "#"
+
+// Emitter emits metrics about completed runs to a StatsD or DogStatsD server by UDP.
+// Each completed run increments a counter, and reports its duration as a distribution (or a timer in plain StatsD)
+// and as a gauge. Tags are the ones labelling the metrics of the run, including populated labels
+type Emitter struct {
+	config    config.StatsDOutputConfig
+	collector *metrics.Collector
+	queue     chan store.Run
+
+	connection net.Conn
+	buffer     bytes.Buffer
+}
+
+// NewEmitter return a new Emitter. The collector is used to get the populated labels of the runs
+func NewEmitter(collector *metrics.Collector, statsdConfig config.StatsDOutputConfig) (emitter *Emitter, err error) {
+	connection, err := net.Dial("udp", statsdConfig.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	emitter = &Emitter{
+		config:     statsdConfig,
+		collector:  collector,
+		queue:      make(chan store.Run, eventsQueueSize),
+		connection: connection,
+	}
+
+	globals.ExecContext.Logger.Infof(emittingMetricsMessage, statsdConfig.Flavor, statsdConfig.Address)
+	return emitter, nil
+}
+
+// HandleRunEvent enqueue completed runs to be emitted.
+// It implements kubernetes.RunHandler interface
+func (e *Emitter) HandleRunEvent(ctx *context.Context, event kubernetes.RunEvent) {
+	if event.Transition != kubernetes.RunTransitionCompleted {
+		return
+	}
+
+	select {
+	case e.queue <- event.StoreRun:
+	default:
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Warnf(queueFullMessage, event.StoreRun.Kind, event.StoreRun.Namespace, event.StoreRun.Name)
+	}
+}
+
+// Run emit the metrics of the queued runs until the context is done.
+// Metrics are buffered into packets, which are sent when they are full or every flush interval.
+// On shutdown, queued runs are emitted and the last packet is sent
+// Hey!, this function is intended to be executed as a go routine
+func (e *Emitter) Run(ctx context.Context) {
+	defer e.connection.Close()
+
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case run := <-e.queue:
+			e.emitRun(&run)
+
+		case <-ticker.C:
+			e.flush()
+
+		case <-ctx.Done():
+			for len(e.queue) > 0 {
+				run := <-e.queue
+				e.emitRun(&run)
+			}
+			e.flush()
+			return
+		}
+	}
+}
+
+// emitRun write the metrics of a completed run into the buffer.
+// Plain StatsD has no tags, so the dimensions of the run are encoded in the names of its metrics instead
+func (e *Emitter) emitRun(run *store.Run) {
+	name := e.config.Prefix + strings.ToLower(run.Kind) + "."
+	tags := e.getTags(run)
+
+	if e.config.Flavor != config.StatsDFlavorDogStatsD {
+		name += getNameSegments(run)
+	}
+
+	e.write(name+"completed", "1", metricTypeCounter, tags)
+	e.write(name+"last_duration_seconds", formatFloat(run.Duration()), metricTypeGauge, tags)
+
+	// Plain StatsD has no distributions, so durations are sent as timers, which are expressed in milliseconds
+	if e.config.Flavor == config.StatsDFlavorDogStatsD {
+		e.write(name+"duration_seconds", formatFloat(run.Duration()), metricTypeDistribution, tags)
+	} else {
+		e.write(name+"duration", formatFloat(run.Duration()*1000), metricTypeTimer, tags)
+	}
+
+	if run.Kind == tekton.TaskRunKind {
+		e.write(name+"retries", strconv.Itoa(run.Retries), metricTypeGauge, tags)
+	}
+}
+
+// getTags return the tags of the metrics of a run, sorted by name, as 'name:value'.
+// They are the labels of its metrics, excluding those identifying each run (i.e. name or uid) to bound cardinality
+func (e *Emitter) getTags(run *store.Run) (tags []string) {
+	tagValues := make(map[string]string)
+
+	for tagName, tagValue := range e.config.Tags {
+		tagValues[tagName] = tagValue
+	}
+
+	for tagName, tagValue := range e.collector.GetPopulatedLabels(run) {
+		tagValues[tagName] = tagValue
+	}
+
+	if run.Cluster != "" {
+		tagValues["cluster"] = run.Cluster
+	}
+	tagValues["namespace"] = run.Namespace
+	tagValues["pipeline"] = run.Pipeline
+	tagValues["status"] = run.Status
+	tagValues["reason"] = run.Reason
+	if run.Kind == tekton.TaskRunKind {
+		tagValues["task"] = run.Task
+	}
+
+	for tagName, tagValue := range tagValues {
+		tags = append(tags, tagReplacer.Replace(tagName)+":"+tagReplacer.Replace(tagValue))
+	}
+	sort.Strings(tags)
+
+	return tags
+}
+
+// getNameSegments return the dimensions of a run as segments of a metric name, for plain StatsD:
+// '[<cluster>.]<namespace>.<pipeline>.[<task>.]<status>.'. Unknown pipelines and tasks are named 'unknown'
+func getNameSegments(run *store.Run) string {
+	var segments []string
+
+	if run.Cluster != "" {
+		segments = append(segments, run.Cluster)
+	}
+	segments = append(segments, run.Namespace, run.Pipeline)
+	if run.Kind == tekton.TaskRunKind {
+		segments = append(segments, run.Task)
+	}
+	segments = append(segments, run.Status)
+
+	for index, segment := range segments {
+		if segment == unknownValue || segment == "" {
+			segment = "unknown"
+		}
+		segments[index] = segmentReplacer.Replace(segment)
+	}
+
+	return strings.Join(segments, ".") + "."
+}
+
+// write add a metric to the buffer, as a line of the protocol. Tags are only written in DogStatsD flavor.
+// When the line does not fit into the current packet, the buffer is sent first
+func (e *Emitter) write(name, value, metricType string, tags []string) {
+	line := nameReplacer.Replace(name) + ":" + value + "|" + metricType
+	if e.config.Flavor == config.StatsDFlavorDogStatsD && len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	if e.buffer.Len() > 0 && e.buffer.Len()+len(line)+1 > e.config.MaxPacketSize {
+		e.flush()
+	}
+
+	if e.buffer.Len() > 0 {
+		e.buffer.WriteByte('\n')
+	}
+	e.buffer.WriteString(line)
+}
+
+// flush send the buffered metrics in a single packet
+func (e *Emitter) flush() {
+	if e.buffer.Len() == 0 {
+		return
+	}
+	defer e.buffer.Reset()
+
+	_, err := e.connection.Write(e.buffer.Bytes())
+	if err != nil {
+		metrics.OutputErrors.WithLabelValues(outputName).Inc()
+		globals.ExecContext.Logger.Errorf(sendErrorMessage, err)
+	}
+}
+
+// formatFloat format a float without exponent nor trailing zeros, as StatsD servers expect
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,191 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	//
+	"tekton-exporter/internal/config"
+	"tekton-exporter/internal/globals"
+	"tekton-exporter/internal/kubernetes"
+	"tekton-exporter/internal/metrics"
+	"tekton-exporter/internal/store"
+	"tekton-exporter/internal/tekton"
+)
+
+// newTestRun return a completed run of a kind, labelled with its team
+func newTestRun(kind string) store.Run {
+	startTime := time.Date(2024, 5, 2, 10, 15, 0, 0, time.UTC)
+	return store.Run{
+		Kind:           kind,
+		Namespace:      "ci",
+		Name:           "build-x7k2p",
+		UID:            "3f6c1a2e",
+		Pipeline:       "build",
+		Task:           "unit-tests",
+		Status:         "failed",
+		Reason:         "Failed",
+		Labels:         map[string]string{"team": "payments"},
+		StartTime:      startTime,
+		CompletionTime: startTime.Add(90 * time.Second),
+		Retries:        2,
+	}
+}
+
+// emitRuns emit the metrics of the runs to a local UDP listener, returning the packets it receives
+func emitRuns(t *testing.T, statsdConfig config.StatsDOutputConfig, runs ...store.Run) (packets []string) {
+	globals.ExecContext.Logger = *zap.NewNop().Sugar()
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("impossible to listen: %v", err)
+	}
+	defer listener.Close()
+
+	collector := metrics.NewCollector(store.NewStore(0), metrics.CollectorOptions{
+		PopulatedLabels:     []string{"team"},
+		LabelsPlacement:     config.LabelsPlacementInfo,
+		FlakinessWindowSize: 10,
+		RunKinds:            []metrics.RunKindMetrics{{Kind: tekton.PipelineRunKind}, {Kind: tekton.TaskRunKind}},
+	})
+
+	statsdConfig.Address = listener.LocalAddr().String()
+	statsdConfig.Prefix = "tekton_exporter."
+	statsdConfig.FlushInterval = time.Hour
+
+	emitter, err := NewEmitter(collector, statsdConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, run := range runs {
+		emitter.HandleRunEvent(&ctx, kubernetes.RunEvent{Transition: kubernetes.RunTransitionCompleted, StoreRun: run})
+	}
+
+	// Queued runs are emitted on shutdown, and the last packet is sent
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	emitter.Run(cancelledCtx)
+
+	buffer := make([]byte, 65535)
+	for {
+		_ = listener.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		size, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, string(buffer[:size]))
+	}
+}
+
+func assertPackets(t *testing.T, packets []string, expectedPackets []string) {
+	if len(packets) != len(expectedPackets) {
+		t.Fatalf("expected %d packets, got %d:\n%s", len(expectedPackets), len(packets), strings.Join(packets, "\n--\n"))
+	}
+
+	for index := range packets {
+		if packets[index] != expectedPackets[index] {
+			t.Errorf("unexpected packet %d:\n%s\nexpected:\n%s", index, packets[index], expectedPackets[index])
+		}
+	}
+}
+
+func TestEmitDogStatsD(t *testing.T) {
+	packets := emitRuns(t, config.StatsDOutputConfig{
+		Flavor:        config.StatsDFlavorDogStatsD,
+		Tags:          map[string]string{"env": "prod"},
+		MaxPacketSize: 1432,
+	}, newTestRun(tekton.TaskRunKind))
+
+	tags := "|#env:prod,namespace:ci,pipeline:build,reason:Failed,status:failed,task:unit-tests,team:payments"
+	assertPackets(t, packets, []string{strings.Join([]string{
+		"tekton_exporter.taskrun.completed:1|c" + tags,
+		"tekton_exporter.taskrun.last_duration_seconds:90|g" + tags,
+		"tekton_exporter.taskrun.duration_seconds:90|d" + tags,
+		"tekton_exporter.taskrun.retries:2|g" + tags,
+	}, "\n")})
+}
+
+func TestEmitStatsD(t *testing.T) {
+	run := newTestRun(tekton.PipelineRunKind)
+	run.Cluster = "east"
+	run.Task = "#"
+
+	packets := emitRuns(t, config.StatsDOutputConfig{
+		Flavor:        config.StatsDFlavorStatsD,
+		Tags:          map[string]string{"env": "prod"},
+		MaxPacketSize: 1432,
+	}, run, newTestRun(tekton.TaskRunKind))
+
+	// Plain StatsD has no tags, so dimensions are in the names, and durations are timers in milliseconds
+	assertPackets(t, packets, []string{strings.Join([]string{
+		"tekton_exporter.pipelinerun.east.ci.build.failed.completed:1|c",
+		"tekton_exporter.pipelinerun.east.ci.build.failed.last_duration_seconds:90|g",
+		"tekton_exporter.pipelinerun.east.ci.build.failed.duration:90000|ms",
+		"tekton_exporter.taskrun.ci.build.unit-tests.failed.completed:1|c",
+		"tekton_exporter.taskrun.ci.build.unit-tests.failed.last_duration_seconds:90|g",
+		"tekton_exporter.taskrun.ci.build.unit-tests.failed.duration:90000|ms",
+		"tekton_exporter.taskrun.ci.build.unit-tests.failed.retries:2|g",
+	}, "\n")})
+}
+
+func TestEmitSplitsPackets(t *testing.T) {
+	lines := []string{
+		"tekton_exporter.pipelinerun.ci.build.failed.completed:1|c",
+		"tekton_exporter.pipelinerun.ci.build.failed.last_duration_seconds:90|g",
+		"tekton_exporter.pipelinerun.ci.build.failed.duration:90000|ms",
+	}
+
+	// The first two lines fit exactly into a packet, so the third one goes into the next one
+	packets := emitRuns(t, config.StatsDOutputConfig{
+		Flavor:        config.StatsDFlavorStatsD,
+		MaxPacketSize: len(lines[0]) + 1 + len(lines[1]),
+	}, newTestRun(tekton.PipelineRunKind))
+
+	assertPackets(t, packets, []string{lines[0] + "\n" + lines[1], lines[2]})
+
+	for _, packet := range packets {
+		if len(packet) > len(lines[0])+1+len(lines[1]) {
+			t.Errorf("expected packets not to exceed the maximum size, got %d bytes", len(packet))
+		}
+	}
+}
+
+func TestGetNameSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		run      store.Run
+		expected string
+	}{
+		{
+			name:     "pipeline run",
+			run:      store.Run{Kind: tekton.PipelineRunKind, Namespace: "ci", Pipeline: "build", Task: "#", Status: "success"},
+			expected: "ci.build.success.",
+		},
+		{
+			name: "task run in a cluster",
+			run: store.Run{Kind: tekton.TaskRunKind, Cluster: "east", Namespace: "ci", Pipeline: "build",
+				Task: "unit-tests", Status: "failed"},
+			expected: "east.ci.build.unit-tests.failed.",
+		},
+		{
+			name:     "standalone task run with reserved characters",
+			run:      store.Run{Kind: tekton.TaskRunKind, Namespace: "ci", Pipeline: "#", Task: "lint.go:v1", Status: "success"},
+			expected: "ci.unknown.lint_go_v1.success.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if segments := getNameSegments(&test.run); segments != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, segments)
+			}
+		})
+	}
+}
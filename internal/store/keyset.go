@@ -0,0 +1,62 @@
+package store
+
+import (
+	"sync"
+)
+
+// KeySet is a set of keys bounded in size. When it is full, the oldest keys are forgotten first,
+// so it can remember keys for a long time (i.e. runs already processed) without growing forever
+type KeySet struct {
+	capacity int
+
+	mutex sync.Mutex
+	keys  map[string]struct{}
+
+	// order contains the keys in insertion order, so the oldest one is the first
+	order []string
+}
+
+// NewKeySet return a new empty KeySet that remembers up to capacity keys
+func NewKeySet(capacity int) *KeySet {
+	return &KeySet{
+		capacity: capacity,
+		keys:     make(map[string]struct{}),
+	}
+}
+
+// Add add a key to the set, forgetting the oldest one when it is full.
+// It return false when the key was already in the set
+func (s *KeySet) Add(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.keys[key]; found {
+		return false
+	}
+
+	if len(s.order) >= s.capacity {
+		delete(s.keys, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	s.keys[key] = struct{}{}
+	s.order = append(s.order, key)
+	return true
+}
+
+// Contains return true when the key is in the set
+func (s *KeySet) Contains(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, found := s.keys[key]
+	return found
+}
+
+// Len return the amount of keys in the set
+func (s *KeySet) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.keys)
+}
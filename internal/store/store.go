@@ -0,0 +1,192 @@
+package store
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Run represents a normalised Tekton run (i.e. PipelineRun, TaskRun) with the data exported in metrics
+type Run struct {
+	// Cluster is the name of the cluster the run comes from. It is empty when a single cluster is watched
+	Cluster string
+
+	Kind      string
+	Name      string
+	Namespace string
+	UID       string
+
+	// Pipeline and Task are the names of the pipeline and task the run belongs to, or '#' when unknown
+	Pipeline string
+	Task     string
+
+	// Status is 'success' or 'failed', and Reason is the reason of the 'Succeeded' condition
+	Status string
+	Reason string
+
+	// StartTime and CompletionTime are zero until they are reported by Tekton
+	StartTime      time.Time
+	CompletionTime time.Time
+
+	Retries int
+
+	// Labels are all the labels of the object. Those exposed on metrics are selected at scrape time,
+	// so changes in configuration apply to runs already stored
+	Labels map[string]string
+
+	// GitLabels contains 'repository', 'revision' and 'branch' of the code processed by the run, when found
+	GitLabels map[string]string
+
+	// DeploymentService is the name of the deployed service, only for runs marked as deployments
+	DeploymentService string
+}
+
+// Key return a key that identifies a run across events
+func (r *Run) Key() string {
+	return strings.Join([]string{r.Cluster, r.Kind, r.Namespace, r.Name, r.UID}, "/")
+}
+
+// IsCompleted return true when the run has reached a terminal state
+func (r *Run) IsCompleted() bool {
+	return !r.CompletionTime.IsZero()
+}
+
+// IsSucceeded return true when the run has succeeded
+func (r *Run) IsSucceeded() bool {
+	return r.Status == "success"
+}
+
+// Duration return the seconds lasted by a completed run, or zero for runs that are not completed
+func (r *Run) Duration() float64 {
+	if r.StartTime.IsZero() || r.CompletionTime.IsZero() {
+		return 0
+	}
+	return r.CompletionTime.Sub(r.StartTime).Seconds()
+}
+
+// maxExpiredRuns is the amount of expired runs remembered, so they are not stored again when they are listed
+// or modified after their TTL. It is large enough to remember the runs purged during several days in busy clusters
+const maxExpiredRuns = 100000
+
+// Store keeps the latest state of the runs in memory
+type Store struct {
+	// completedRunsTTL is the time completed runs are kept after their completion. Zero means forever
+	completedRunsTTL time.Duration
+
+	mutex sync.RWMutex
+	runs  map[string]Run
+
+	// expiredRuns are the keys of the runs purged by their TTL. They outlive the TTL, as the objects
+	// can remain in the cluster for longer, and they would be stored and accounted again on each relist
+	expiredRuns *KeySet
+}
+
+// NewStore return a new empty Store that forgets completed runs once completedRunsTTL has passed.
+// When completedRunsTTL is zero, runs are kept until they are deleted
+func NewStore(completedRunsTTL time.Duration) *Store {
+	return &Store{
+		completedRunsTTL: completedRunsTTL,
+		runs:             make(map[string]Run),
+		expiredRuns:      NewKeySet(maxExpiredRuns),
+	}
+}
+
+// Upsert store the latest state of a run and return the previous one, when it existed.
+// Runs already purged by their TTL are not stored again, and expired is returned true for them
+func (s *Store) Upsert(run Run) (previous Run, found bool, expired bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.expiredRuns.Contains(run.Key()) {
+		return Run{}, false, true
+	}
+
+	previous, found = s.runs[run.Key()]
+	s.runs[run.Key()] = run
+
+	return previous, found, false
+}
+
+// Delete remove a run from the store
+func (s *Store) Delete(run Run) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.runs, run.Key())
+}
+
+// DeleteFunc remove all the runs for which shouldDelete return true
+func (s *Store) DeleteFunc(shouldDelete func(run *Run) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, run := range s.runs {
+		if shouldDelete(&run) {
+			delete(s.runs, key)
+		}
+	}
+}
+
+// SetCompletedRunsTTL change the time completed runs are kept after their completion
+func (s *Store) SetCompletedRunsTTL(completedRunsTTL time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.completedRunsTTL = completedRunsTTL
+}
+
+// List return a copy of all the runs in the store. Expired runs are purged before listing
+func (s *Store) List() (runs []Run) {
+	s.purgeExpired()
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	runs = make([]Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+
+	return runs
+}
+
+// Len return the amount of runs in the store
+func (s *Store) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.runs)
+}
+
+// CountByKind return the amount of runs in the store of each kind. Expired runs are purged before counting
+func (s *Store) CountByKind() (counts map[string]int) {
+	s.purgeExpired()
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	counts = make(map[string]int)
+	for _, run := range s.runs {
+		counts[run.Kind]++
+	}
+
+	return counts
+}
+
+// purgeExpired remove the completed runs whose TTL has passed, remembering them as expired
+func (s *Store) purgeExpired() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.completedRunsTTL == 0 {
+		return
+	}
+
+	expirationTime := time.Now().Add(-s.completedRunsTTL)
+	for key, run := range s.runs {
+		if run.IsCompleted() && run.CompletionTime.Before(expirationTime) {
+			s.expiredRuns.Add(key)
+			delete(s.runs, key)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package tekton
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// SucceededConditionType is the condition used by Tekton to report the outcome of a run
+	SucceededConditionType = "Succeeded"
+)
+
+var (
+	// cancelledReasons are the reasons of the 'Succeeded' condition of runs cancelled by users,
+	// including the ones used by older versions of Tekton
+	cancelledReasons = []string{"Cancelled", "PipelineRunCancelled", "TaskRunCancelled", "CancelledRunFinally", "StoppedRunFinally"}
+)
+
+// NewRunFromUnstructured decode a run of the given kind from its unstructured representation.
+// Decoding is done once, so the rest of the exporter can rely on typed fields
+func NewRunFromUnstructured(kind string, object map[string]interface{}) (run *Run, err error) {
+	run = &Run{}
+
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(object, run)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", kind, err)
+	}
+
+	// Kind is not always present (i.e. objects in lists), so it is forced
+	run.Kind = kind
+
+	if run.Metadata.Name == "" || run.Metadata.Namespace == "" {
+		return nil, fmt.Errorf("failed to decode %s: %w", kind, errors.New("name or namespace not found in metadata"))
+	}
+
+	return run, nil
+}
+
+// GetCondition return the condition of the requested type, when present
+func (r *Run) GetCondition(conditionType string) (condition Condition, found bool) {
+	for _, condition = range r.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition, true
+		}
+	}
+	return Condition{}, false
+}
+
+// IsCompleted return true when the run has reached a terminal state.
+// Tekton only sets 'status.completionTime' when a run is done (successfully or not)
+func (r *Run) IsCompleted() bool {
+	return r.Status.CompletionTime != nil
+}
+
+// IsSucceeded return true when the 'Succeeded' condition of the run is 'True'
+func (r *Run) IsSucceeded() bool {
+	condition, found := r.GetCondition(SucceededConditionType)
+	return found && condition.Status == "True"
+}
+
+// IsCancelled return true when the run has been cancelled by a user (i.e. setting 'spec.status: Cancelled')
+func (r *Run) IsCancelled() bool {
+	condition, found := r.GetCondition(SucceededConditionType)
+	return found && condition.Status == "False" && slices.Contains(cancelledReasons, condition.Reason)
+}
+
+// GetPipelineName return the name of the pipeline the run belongs to, or an empty string when unknown
+func (r *Run) GetPipelineName() string {
+	if pipelineName := r.Metadata.Labels["tekton.dev/pipeline"]; pipelineName != "" {
+		return pipelineName
+	}
+
+	if r.Spec.PipelineRef != nil {
+		return r.Spec.PipelineRef.Name
+	}
+
+	return ""
+}
+
+// GetTaskName return the name of the task executed by a TaskRun, or an empty string when unknown.
+// The name of the task inside the pipeline is preferred, as the same Task can be used several times in a Pipeline
+func (r *Run) GetTaskName() string {
+	for _, labelName := range []string{"tekton.dev/pipelineTask", "tekton.dev/task"} {
+		if taskName := r.Metadata.Labels[labelName]; taskName != "" {
+			return taskName
+		}
+	}
+
+	if r.Spec.TaskRef != nil {
+		return r.Spec.TaskRef.Name
+	}
+
+	return ""
+}
+
+// GetRetries return the number of retries performed by the run.
+// Tekton stores the status of each failed attempt in 'status.retriesStatus'
+func (r *Run) GetRetries() int {
+	return len(r.Status.RetriesStatus)
+}
+
+// GetStringParams return the params of the run whose value is a string,
+// as arrays and objects are not suitable for metrics
+func (r *Run) GetStringParams() (params map[string]string) {
+	params = make(map[string]string)
+	for _, param := range r.Spec.Params {
+		if paramValue, ok := param.Value.(string); ok {
+			params[param.Name] = paramValue
+		}
+	}
+	return params
+}
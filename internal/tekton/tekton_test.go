@@ -0,0 +1,280 @@
+package tekton
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// loadFixture return the unstructured representation of an object in testdata,
+// as it is received from Kubernetes API
+func loadFixture(t *testing.T, fileName string) map[string]interface{} {
+	t.Helper()
+
+	fileContent, err := os.ReadFile(filepath.Join("testdata", fileName))
+	if err != nil {
+		t.Fatalf("impossible to read fixture: %v", err)
+	}
+
+	jsonContent, err := yaml.ToJSON(fileContent)
+	if err != nil {
+		t.Fatalf("impossible to convert fixture to JSON: %v", err)
+	}
+
+	object := &unstructured.Unstructured{}
+	err = object.UnmarshalJSON(jsonContent)
+	if err != nil {
+		t.Fatalf("impossible to decode fixture: %v", err)
+	}
+
+	return object.Object
+}
+
+func parseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+
+	parsedTime, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("impossible to parse time: %v", err)
+	}
+	return parsedTime
+}
+
+func TestNewRunFromUnstructured(t *testing.T) {
+	tests := []struct {
+		fixture string
+		kind    string
+
+		name           string
+		uid            string
+		pipeline       string
+		task           string
+		params         map[string]string
+		startTime      string
+		completionTime string
+
+		completed bool
+		succeeded bool
+		cancelled bool
+		retries   int
+		reason    string
+	}{
+		{
+			fixture:        "pipelinerun-succeeded.yaml",
+			kind:           PipelineRunKind,
+			name:           "build-x7k2p",
+			uid:            "3f6c1a2e-8d4b-4c1e-9a57-0b2f1e6d9c10",
+			pipeline:       "build",
+			params:         map[string]string{"revision": "main"},
+			startTime:      "2024-05-02T10:15:00Z",
+			completionTime: "2024-05-02T10:19:42Z",
+			completed:      true,
+			succeeded:      true,
+			reason:         "Succeeded",
+		},
+		{
+			fixture:        "pipelinerun-failed.yaml",
+			kind:           PipelineRunKind,
+			name:           "deploy-q9w8e",
+			uid:            "8a2d4f6b-1c3e-4a5b-9d7f-2e4c6a8b0d1f",
+			params:         map[string]string{},
+			startTime:      "2024-05-02T11:00:02Z",
+			completionTime: "2024-05-02T11:03:30Z",
+			completed:      true,
+			reason:         "Failed",
+		},
+		{
+			fixture:        "pipelinerun-cancelled.yaml",
+			kind:           PipelineRunKind,
+			name:           "build-c4nc3",
+			uid:            "5b7d9f1a-3c5e-4b6d-8f0a-1c3e5a7b9d2f",
+			pipeline:       "build",
+			params:         map[string]string{},
+			startTime:      "2024-05-02T12:00:01Z",
+			completionTime: "2024-05-02T12:01:10Z",
+			completed:      true,
+			cancelled:      true,
+			reason:         "Cancelled",
+		},
+		{
+			fixture:        "taskrun-retried.yaml",
+			kind:           TaskRunKind,
+			name:           "build-x7k2p-test",
+			uid:            "9c1e3a5b-7d9f-4e2a-8c4e-6a8b0c2d4e6f",
+			pipeline:       "build",
+			task:           "unit-tests",
+			params:         map[string]string{"packages": "./..."},
+			startTime:      "2024-05-02T10:18:00Z",
+			completionTime: "2024-05-02T10:18:45Z",
+			completed:      true,
+			succeeded:      true,
+			retries:        2,
+			reason:         "Succeeded",
+		},
+		{
+			fixture:   "taskrun-missing-conditions.yaml",
+			kind:      TaskRunKind,
+			name:      "lint-p0d5x",
+			uid:       "2d4f6a8c-0e2a-4c6e-8a0c-4e6a8c0e2a4c",
+			task:      "golangci-lint",
+			params:    map[string]string{},
+			startTime: "2024-05-02T13:00:01Z",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			run, err := NewRunFromUnstructured(test.kind, loadFixture(t, test.fixture))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if run.Kind != test.kind || run.Metadata.Name != test.name || run.Metadata.Namespace != "ci" ||
+				string(run.Metadata.UID) != test.uid {
+				t.Errorf("unexpected identity: %s %s/%s (%s)", run.Kind, run.Metadata.Namespace, run.Metadata.Name, run.Metadata.UID)
+			}
+
+			if pipeline := run.GetPipelineName(); pipeline != test.pipeline {
+				t.Errorf("expected pipeline %q, got %q", test.pipeline, pipeline)
+			}
+			if task := run.GetTaskName(); task != test.task {
+				t.Errorf("expected task %q, got %q", test.task, task)
+			}
+			if params := run.GetStringParams(); !reflect.DeepEqual(params, test.params) {
+				t.Errorf("expected params %v, got %v", test.params, params)
+			}
+
+			if run.Status.StartTime == nil || !run.Status.StartTime.Time.Equal(parseTime(t, test.startTime)) {
+				t.Errorf("expected start time %s, got %v", test.startTime, run.Status.StartTime)
+			}
+			if test.completionTime == "" {
+				if run.Status.CompletionTime != nil {
+					t.Errorf("expected no completion time, got %v", run.Status.CompletionTime)
+				}
+			} else if run.Status.CompletionTime == nil || !run.Status.CompletionTime.Time.Equal(parseTime(t, test.completionTime)) {
+				t.Errorf("expected completion time %s, got %v", test.completionTime, run.Status.CompletionTime)
+			}
+
+			if run.IsCompleted() != test.completed || run.IsSucceeded() != test.succeeded || run.IsCancelled() != test.cancelled {
+				t.Errorf("expected completed=%t succeeded=%t cancelled=%t, got completed=%t succeeded=%t cancelled=%t",
+					test.completed, test.succeeded, test.cancelled, run.IsCompleted(), run.IsSucceeded(), run.IsCancelled())
+			}
+			if retries := run.GetRetries(); retries != test.retries {
+				t.Errorf("expected %d retries, got %d", test.retries, retries)
+			}
+
+			condition, found := run.GetCondition(SucceededConditionType)
+			if found != (test.reason != "") || condition.Reason != test.reason {
+				t.Errorf("expected condition reason %q, got %q (found: %t)", test.reason, condition.Reason, found)
+			}
+		})
+	}
+}
+
+func TestNewRunFromUnstructuredPipelineRunDetails(t *testing.T) {
+	run, err := NewRunFromUnstructured(PipelineRunKind, loadFixture(t, "pipelinerun-succeeded.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedChildReferences := []ChildReference{
+		{Kind: TaskRunKind, Name: "build-x7k2p-clone", PipelineTaskName: "clone"},
+		{Kind: TaskRunKind, Name: "build-x7k2p-build", PipelineTaskName: "build"},
+	}
+	if !reflect.DeepEqual(run.Status.ChildReferences, expectedChildReferences) {
+		t.Errorf("expected child references %+v, got %+v", expectedChildReferences, run.Status.ChildReferences)
+	}
+
+	expectedRefSource := &RefSource{
+		URI:        "git+https://github.com/example/pipelines.git",
+		Digest:     map[string]string{"sha1": "0e9b8c7d6e5f4a3b9b1e4c0d2f7a8e3b6c5d4f1a"},
+		EntryPoint: "pipelines/build.yaml",
+	}
+	if run.Status.Provenance == nil || !reflect.DeepEqual(run.Status.Provenance.RefSource, expectedRefSource) {
+		t.Errorf("expected provenance %+v, got %+v", expectedRefSource, run.Status.Provenance)
+	}
+
+	if len(run.Status.Results) != 1 || run.Status.Results[0].Name != "image-digest" {
+		t.Errorf("unexpected results: %+v", run.Status.Results)
+	}
+
+	// Params which are not strings are decoded, but they are not suitable for metrics
+	if len(run.Spec.Params) != 2 || !reflect.DeepEqual(run.Spec.Params[1].Value, []interface{}{"linux/amd64", "linux/arm64"}) {
+		t.Errorf("unexpected params: %+v", run.Spec.Params)
+	}
+}
+
+func TestNewRunFromUnstructuredTaskRunDetails(t *testing.T) {
+	run, err := NewRunFromUnstructured(TaskRunKind, loadFixture(t, "taskrun-retried.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if run.Spec.TaskRef == nil || *run.Spec.TaskRef != (Ref{Kind: "Task", Name: "go-test"}) {
+		t.Errorf("unexpected task reference: %+v", run.Spec.TaskRef)
+	}
+
+	if len(run.Status.Steps) != 1 {
+		t.Fatalf("expected 1 step, got %d", len(run.Status.Steps))
+	}
+	step := run.Status.Steps[0]
+	if step.Name != "test" || step.Container != "step-test" || step.Terminated == nil {
+		t.Fatalf("unexpected step: %+v", step)
+	}
+	if step.Terminated.ExitCode != 0 || step.Terminated.Reason != "Completed" ||
+		!step.Terminated.StartedAt.Time.Equal(parseTime(t, "2024-05-02T10:18:02Z")) ||
+		!step.Terminated.FinishedAt.Time.Equal(parseTime(t, "2024-05-02T10:18:44Z")) {
+		t.Errorf("unexpected step termination: %+v", step.Terminated)
+	}
+
+	for _, retryStatus := range run.Status.RetriesStatus {
+		if len(retryStatus.Conditions) != 1 || retryStatus.Conditions[0].Reason != "Failed" {
+			t.Errorf("unexpected retry status: %+v", retryStatus)
+		}
+	}
+}
+
+func TestNewRunFromUnstructuredErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		kind    string
+		err     string
+	}{
+		{
+			fixture: "pipelinerun-malformed-start-time.yaml",
+			kind:    PipelineRunKind,
+			err:     "failed to decode PipelineRun",
+		},
+		{
+			fixture: "taskrun-malformed-conditions.yaml",
+			kind:    TaskRunKind,
+			err:     "failed to decode TaskRun",
+		},
+		{
+			fixture: "taskrun-missing-namespace.yaml",
+			kind:    TaskRunKind,
+			err:     "failed to decode TaskRun: name or namespace not found in metadata",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			run, err := NewRunFromUnstructured(test.kind, loadFixture(t, test.fixture))
+			if err == nil {
+				t.Fatalf("expected an error, got run %+v", run)
+			}
+			if !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("expected error starting by %q, got %q", test.err, err)
+			}
+			if run != nil {
+				t.Errorf("expected no run on errors, got %+v", run)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package tekton
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	PipelineRunKind = "PipelineRun"
+	TaskRunKind     = "TaskRun"
+)
+
+// Run represents a Tekton run (i.e. PipelineRun, TaskRun) with the fields used by the exporter.
+// Fields are a subset of Tekton v1 API, shared by both kinds. Those not present in a kind are empty
+// Ref: https://tekton.dev/docs/pipelines/pipeline-api/
+type Run struct {
+	Kind     string            `json:"kind"`
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Spec     RunSpec           `json:"spec"`
+	Status   RunStatus         `json:"status"`
+}
+
+// RunSpec represents the spec of a run
+type RunSpec struct {
+	PipelineRef *Ref    `json:"pipelineRef,omitempty"`
+	TaskRef     *Ref    `json:"taskRef,omitempty"`
+	Params      []Param `json:"params,omitempty"`
+}
+
+// Ref represents a reference to a Pipeline or a Task
+type Ref struct {
+	Name     string `json:"name,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Resolver string `json:"resolver,omitempty"`
+}
+
+// Param represents a param passed to a run.
+// Values can be strings, arrays or objects
+type Param struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// RunStatus represents the status of a run
+type RunStatus struct {
+	Conditions     []Condition  `json:"conditions,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Steps are only reported by TaskRuns
+	Steps []StepState `json:"steps,omitempty"`
+
+	// Results are reported by both kinds. TaskRuns use 'results' since v1
+	Results []Result `json:"results,omitempty"`
+
+	// ChildReferences are only reported by PipelineRuns
+	ChildReferences []ChildReference `json:"childReferences,omitempty"`
+
+	// RetriesStatus are only reported by TaskRuns, one per failed attempt
+	RetriesStatus []RunStatus `json:"retriesStatus,omitempty"`
+
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// Condition represents a condition of a run (i.e. 'Succeeded')
+type Condition struct {
+	Type               string      `json:"type"`
+	Status             string      `json:"status"`
+	Reason             string      `json:"reason,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// StepState represents the state of a step of a TaskRun
+type StepState struct {
+	corev1.ContainerState `json:",inline"`
+
+	Name      string `json:"name,omitempty"`
+	Container string `json:"container,omitempty"`
+	ImageID   string `json:"imageID,omitempty"`
+}
+
+// Result represents a result emitted by a run.
+// Values can be strings, arrays or objects
+type Result struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// ChildReference represents a run created by a PipelineRun
+type ChildReference struct {
+	Kind             string `json:"kind,omitempty"`
+	Name             string `json:"name,omitempty"`
+	PipelineTaskName string `json:"pipelineTaskName,omitempty"`
+}
+
+// Provenance represents the source of the definition used by a run
+type Provenance struct {
+	RefSource *RefSource `json:"refSource,omitempty"`
+}
+
+// RefSource represents the source of a remote definition (i.e. a git repository)
+type RefSource struct {
+	URI        string            `json:"uri,omitempty"`
+	Digest     map[string]string `json:"digest,omitempty"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+}
@@ -0,0 +1,214 @@
+package webserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	//
+	"tekton-exporter/internal/globals"
+)
+
+const (
+	// decisionsCacheTTL is the time authentication and authorization decisions are cached,
+	// so the API server is not requested on every scrape
+	decisionsCacheTTL = time.Minute
+
+	authFailedMessage = "authentication or authorization failed for request to %s: %v"
+)
+
+// KubernetesAuthenticator authenticates requests by bearer tokens using Kubernetes TokenReview,
+// and authorizes them using Kubernetes SubjectAccessReview on the requested path, like kube-rbac-proxy does.
+// Clients authenticated by a verified certificate (mTLS) are identified by its common name and organizations
+type KubernetesAuthenticator struct {
+	client clientset.Interface
+
+	mutex     sync.Mutex
+	decisions map[string]cachedDecision
+}
+
+// cachedDecision represents the result of authenticating and authorizing a request
+type cachedDecision struct {
+	allowed   bool
+	expiresAt time.Time
+}
+
+// NewKubernetesAuthenticator return a new KubernetesAuthenticator using the cluster where the exporter is running
+func NewKubernetesAuthenticator() (authenticator *KubernetesAuthenticator, err error) {
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KubernetesAuthenticator{
+		client:    client,
+		decisions: make(map[string]cachedDecision),
+	}, nil
+}
+
+// Middleware return a handler that only calls next for authenticated and authorized requests
+func (a *KubernetesAuthenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+
+		// Requests without credentials are rejected without requesting the API server
+		if !hasCredentials(request) {
+			http.Error(response, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		allowed, err := a.isAllowed(request)
+		if err != nil {
+			globals.ExecContext.Logger.Errorf(authFailedMessage, request.URL.Path, err)
+		}
+
+		if !allowed {
+			http.Error(response, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(response, request)
+	})
+}
+
+// hasCredentials return true when the request presents a verified client certificate or a bearer token
+func hasCredentials(request *http.Request) bool {
+	if request.TLS != nil && len(request.TLS.VerifiedChains) > 0 {
+		return true
+	}
+
+	token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	return found && token != ""
+}
+
+// isAllowed return true when the request is authenticated and its user is authorized to request the path
+func (a *KubernetesAuthenticator) isAllowed(request *http.Request) (allowed bool, err error) {
+	verb := strings.ToLower(request.Method)
+	path := request.URL.Path
+
+	// Users from verified client certificates are already authenticated
+	if request.TLS != nil && len(request.TLS.VerifiedChains) > 0 {
+		certificate := request.TLS.VerifiedChains[0][0]
+		user := authenticationv1.UserInfo{
+			Username: certificate.Subject.CommonName,
+			Groups:   certificate.Subject.Organization,
+		}
+
+		return a.getCachedDecision("cert:"+getUserKey(user)+":"+verb+":"+path, func() (bool, error) {
+			return a.isAuthorized(request.Context(), user, verb, path)
+		})
+	}
+
+	token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return false, nil
+	}
+
+	// Tokens are hashed, so they are not kept in memory
+	tokenHash := sha256.Sum256([]byte(token))
+	return a.getCachedDecision("token:"+hex.EncodeToString(tokenHash[:])+":"+verb+":"+path, func() (bool, error) {
+		user, authenticated, err := a.authenticate(request.Context(), token)
+		if err != nil || !authenticated {
+			return false, err
+		}
+		return a.isAuthorized(request.Context(), user, verb, path)
+	})
+}
+
+// getUserKey return a key identifying a user by its name and its groups, as authorization depends on both.
+// Groups are sorted, and the key is hashed, so names and groups containing separators can not collide
+func getUserKey(user authenticationv1.UserInfo) string {
+	groups := append([]string{}, user.Groups...)
+	sort.Strings(groups)
+
+	userHash := sha256.Sum256([]byte(strings.Join(append([]string{user.Username}, groups...), "\x00")))
+	return hex.EncodeToString(userHash[:])
+}
+
+// authenticate return the user a token belongs to, using a TokenReview
+func (a *KubernetesAuthenticator) authenticate(ctx context.Context, token string) (user authenticationv1.UserInfo,
+	authenticated bool, err error) {
+
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return user, false, err
+	}
+
+	return review.Status.User, review.Status.Authenticated, nil
+}
+
+// isAuthorized return true when the user is allowed to perform the verb on the non-resource path,
+// using a SubjectAccessReview
+func (a *KubernetesAuthenticator) isAuthorized(ctx context.Context, user authenticationv1.UserInfo,
+	verb, path string) (authorized bool, err error) {
+
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+
+	review, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: path,
+				Verb: verb,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
+
+// getCachedDecision return the cached decision for the key, or the one made by decide when it is not cached.
+// Errors are not cached, so they are retried on next request
+func (a *KubernetesAuthenticator) getCachedDecision(key string, decide func() (bool, error)) (allowed bool, err error) {
+	a.mutex.Lock()
+	decision, found := a.decisions[key]
+	a.mutex.Unlock()
+
+	if found && time.Now().Before(decision.expiresAt) {
+		return decision.allowed, nil
+	}
+
+	allowed, err = decide()
+	if err != nil {
+		return false, err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// Expired decisions are purged here, so the cache does not grow forever
+	for cachedKey, cachedDecision := range a.decisions {
+		if time.Now().After(cachedDecision.expiresAt) {
+			delete(a.decisions, cachedKey)
+		}
+	}
+	a.decisions[key] = cachedDecision{allowed: allowed, expiresAt: time.Now().Add(decisionsCacheTTL)}
+
+	return allowed, nil
+}
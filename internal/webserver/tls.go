@@ -0,0 +1,138 @@
+package webserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	//
+	"tekton-exporter/internal/globals"
+)
+
+const (
+	// reloadDebounceDelay is the time waited after the last change before reloading certificates,
+	// as tools like cert-manager write the certificate and the key separately
+	reloadDebounceDelay = 500 * time.Millisecond
+)
+
+// CertificateReloader keeps a TLS certificate loaded from files, reloading it when they change
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	certificate atomic.Pointer[tls.Certificate]
+}
+
+// NewCertificateReloader return a new CertificateReloader with the certificate already loaded
+func NewCertificateReloader(certFile, keyFile string) (reloader *CertificateReloader, err error) {
+	reloader = &CertificateReloader{certFile: certFile, keyFile: keyFile}
+
+	err = reloader.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// load read the certificate from the files and put it in use
+func (r *CertificateReloader) load() error {
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("impossible to load TLS certificate: %w", err)
+	}
+
+	r.certificate.Store(&certificate)
+	return nil
+}
+
+// GetCertificate return the certificate in use. It is intended to be used in tls.Config
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.certificate.Load(), nil
+}
+
+// Watch reload the certificate each time its files change, until the context is done.
+// Invalid certificates are logged and ignored, so the current one is kept
+// Hey!, this function is intended to be executed as a go routine
+func (r *CertificateReloader) Watch(ctx context.Context) (err error) {
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Directories are watched instead of files, as files mounted from Secrets are replaced, not written
+	for _, directory := range []string{filepath.Dir(r.certFile), filepath.Dir(r.keyFile)} {
+		err = watcher.Add(directory)
+		if err != nil {
+			return err
+		}
+	}
+
+	debounceTimer := time.NewTimer(reloadDebounceDelay)
+	debounceTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			debounceTimer.Reset(reloadDebounceDelay)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			globals.ExecContext.Logger.Errorf("error watching TLS certificate files: %v", err)
+
+		case <-debounceTimer.C:
+			err := r.load()
+			if err != nil {
+				globals.ExecContext.Logger.Errorf("TLS certificate changed but it is invalid, keeping the current one: %v", err)
+				continue
+			}
+			globals.ExecContext.Logger.Info("TLS certificate reloaded")
+		}
+	}
+}
+
+// NewTLSConfig return the TLS configuration of the webserver, serving the certificate of the reloader.
+// When clientCAFile is defined, clients must present a certificate signed by one of its CAs (mTLS)
+func NewTLSConfig(reloader *CertificateReloader, clientCAFile string) (tlsConfig *tls.Config, err error) {
+	tlsConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if clientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	clientCAContent, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("impossible to read client CA file: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(clientCAContent) {
+		return nil, errors.New("no valid certificate found in client CA file")
+	}
+
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return tlsConfig, nil
+}